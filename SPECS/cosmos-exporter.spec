@@ -43,7 +43,7 @@ mkdir -p ${RPM_BUILD_ROOT}/usr/bin/
 mkdir -p ${RPM_BUILD_ROOT}/usr/lib/systemd/system
 
 # Copy the newly built binaries into /usr/bin and /lib64
-cp -v ${RPM_BUILD_DIR}/go/bin/main                     ${RPM_BUILD_ROOT}/usr/bin/cosmos-exporter
+cp -v ${RPM_BUILD_DIR}/go/bin/cosmos-exporter          ${RPM_BUILD_ROOT}/usr/bin/cosmos-exporter
 
 # Install the config files
 cp -v  ${RPM_SOURCE_DIR}/config.json                   ${RPM_BUILD_ROOT}/var/lib/cosmos/
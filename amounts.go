@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+// DenomUnit is the unit the amounts of a base denom are displayed in.
+type DenomUnit struct {
+	Display  string `mapstructure:"display"`
+	Exponent uint32 `mapstructure:"exponent"`
+}
+
+// DenomConfig overrides the display unit of a base denom, as listed in the "denoms" section
+// of the --denoms-config file. Useful for the IBC vouchers and the denoms without metadata.
+type DenomConfig struct {
+	Base      string `mapstructure:"base"`
+	DenomUnit `mapstructure:",squash"`
+}
+
+// Denoms is the registry of the display units of the denoms of a chain, built from the denoms metadata
+// and the overrides. It converts the amounts from base units (e.g. uatom) to display units (e.g. atom).
+// All the arithmetic is done on sdk.Dec, the amounts are only converted to float64 to set the metrics.
+type Denoms struct {
+	// Denom and DenomCoefficient are the display unit of the bond denom,
+	// which the staking amounts without a denom are in.
+	Denom            string
+	DenomCoefficient float64
+
+	bondCoefficient sdk.Dec
+	units           map[string]DenomUnit
+}
+
+// NewDenoms creates a registry of the given display units, by base denom.
+func NewDenoms(denom string, denomCoefficient float64, units map[string]DenomUnit) (*Denoms, error) {
+	bondCoefficient, err := sdk.NewDecFromStr(strconv.FormatFloat(denomCoefficient, 'f', -1, 64))
+	if err != nil {
+		return nil, fmt.Errorf("invalid denom coefficient %v: %w", denomCoefficient, err)
+	}
+
+	if !bondCoefficient.IsPositive() {
+		return nil, fmt.Errorf("invalid denom coefficient %v: must be positive", denomCoefficient)
+	}
+
+	return &Denoms{
+		Denom:            denom,
+		DenomCoefficient: denomCoefficient,
+		bondCoefficient:  bondCoefficient,
+		units:            units,
+	}, nil
+}
+
+// DenomUnits returns the display unit of every denom metadata, with the overrides applied on top.
+func DenomUnits(metadatas []banktypes.Metadata, overrides map[string]DenomUnit) map[string]DenomUnit {
+	units := make(map[string]DenomUnit, len(metadatas)+len(overrides))
+	for _, metadata := range metadatas {
+		for _, unit := range metadata.DenomUnits {
+			if unit.Denom == metadata.Display {
+				units[metadata.Base] = DenomUnit{Display: metadata.Display, Exponent: unit.Exponent}
+			}
+		}
+	}
+
+	for base, unit := range overrides {
+		units[base] = unit
+	}
+
+	return units
+}
+
+// LoadDenomOverrides reads the display units overriding the denoms metadata from a config file.
+func LoadDenomOverrides(path string) (map[string]DenomUnit, error) {
+	overrides := make(map[string]DenomUnit)
+	if path == "" {
+		return overrides, nil
+	}
+
+	config := viper.New()
+	config.SetConfigFile(path)
+	if err := config.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var denomConfigs []DenomConfig
+	if err := config.UnmarshalKey("denoms", &denomConfigs); err != nil {
+		return nil, err
+	}
+
+	for index, denomConfig := range denomConfigs {
+		if denomConfig.Base == "" || denomConfig.Display == "" {
+			return nil, fmt.Errorf("denom #%d: base and display are required", index)
+		}
+
+		if _, ok := overrides[denomConfig.Base]; ok {
+			return nil, fmt.Errorf("denom %q is configured twice", denomConfig.Base)
+		}
+
+		overrides[denomConfig.Base] = denomConfig.DenomUnit
+	}
+
+	return overrides, nil
+}
+
+// BondAmount converts an amount of the bond denom to its display unit.
+func (d *Denoms) BondAmount(amount sdk.Dec) float64 {
+	return DecToFloat64(amount.Quo(d.bondCoefficient))
+}
+
+// BondIntAmount converts an integer amount of the bond denom to its display unit.
+func (d *Denoms) BondIntAmount(amount sdk.Int) float64 {
+	return d.BondAmount(sdk.NewDecFromInt(amount))
+}
+
+// Amount converts an amount to its display unit and returns it with the display denom.
+// The denoms without a display unit are returned as is, in base units, and display is false.
+func (d *Denoms) Amount(denom string, amount sdk.Dec) (value float64, displayDenom string, display bool) {
+	unit, ok := d.units[denom]
+	if !ok {
+		return DecToFloat64(amount), denom, false
+	}
+
+	return DecToFloat64(ScaleDown(amount, unit.Exponent)), unit.Display, true
+}
+
+// CoinAmount converts a coin to its display unit, see Amount.
+func (d *Denoms) CoinAmount(coin sdk.Coin) (float64, string, bool) {
+	return d.Amount(coin.Denom, sdk.NewDecFromInt(coin.Amount))
+}
+
+// ScaleDown divides the amount by 10^exponent.
+func ScaleDown(amount sdk.Dec, exponent uint32) sdk.Dec {
+	return amount.Quo(sdk.NewDec(10).Power(uint64(exponent)))
+}
+
+// DecToFloat64 converts a decimal to the nearest float64. It's the last step before setting a metric.
+func DecToFloat64(amount sdk.Dec) float64 {
+	// the string of a Dec is always a valid float
+	value, _ := amount.Float64()
+	return value
+}
+
+// fetchDenoms fetches the metadata of all the denoms and resolves the display unit of the bond denom,
+// unless both denom and denomCoefficient are provided. The DenomOverrides take precedence over the metadata.
+// The queries are limited by the GrpcTimeoutInterceptor of the connection, which --grpc-timeout=0 disables.
+func fetchDenoms(grpcConn *grpc.ClientConn, denom string, denomCoefficient float64) (*Denoms, error) {
+	ctx := context.Background()
+
+	var metadatas []banktypes.Metadata
+
+	bankClient := banktypes.NewQueryClient(grpcConn)
+	_, err := Paginate(func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+		response, err := bankClient.DenomsMetadata(
+			ctx,
+			&banktypes.QueryDenomsMetadataRequest{Pagination: pageRequest},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		metadatas = append(metadatas, response.Metadatas...)
+		return response.Pagination, nil
+	})
+	units := DenomUnits(metadatas, DenomOverrides)
+
+	// if --denom and --denom-coefficient are both provided, use them
+	// instead of fetching them via gRPC. Can be useful for networks like osmosis.
+	if denom != "" && denomCoefficient != 0 {
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not get denoms metadata, the denoms without overrides are in base units")
+		}
+
+		log.Info().
+			Str("denom", denom).
+			Float64("coefficient", denomCoefficient).
+			Msg("Using provided denom and coefficient.")
+
+		// the bond denom is registered too, as the amounts with a denom (e.g. the rewards)
+		// are converted by denom, and chains like osmosis have no metadata for it
+		stakingClient := stakingtypes.NewQueryClient(grpcConn)
+		paramsResponse, err := stakingClient.Params(ctx, &stakingtypes.QueryParamsRequest{})
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not get the bond denom, its amounts with a denom may be in base units")
+			return NewDenoms(denom, denomCoefficient, units)
+		}
+
+		registerBondDenom(units, paramsResponse.Params.BondDenom, denom, denomCoefficient)
+		return NewDenoms(denom, denomCoefficient, units)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying denoms metadata: %w", err)
+	}
+
+	stakingClient := stakingtypes.NewQueryClient(grpcConn)
+	paramsResponse, err := stakingClient.Params(ctx, &stakingtypes.QueryParamsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error querying bond denom: %w", err)
+	}
+
+	bondDenom := paramsResponse.Params.BondDenom
+
+	if denom == "" { // using display currency
+		unit, ok := units[bondDenom]
+		if !ok {
+			return nil, fmt.Errorf("no denom metadata for the bond denom %s, try setting denom and denom-coefficient manually", bondDenom)
+		}
+
+		denomCoefficient = math.Pow10(int(unit.Exponent))
+		log.Info().
+			Str("denom", unit.Display).
+			Float64("coefficient", denomCoefficient).
+			Msg("Got denom info")
+		return NewDenoms(unit.Display, denomCoefficient, units)
+	}
+
+	for _, metadata := range metadatas {
+		if metadata.Base != bondDenom {
+			continue
+		}
+
+		for _, unit := range metadata.DenomUnits {
+			log.Debug().
+				Str("denom", unit.Denom).
+				Uint32("exponent", unit.Exponent).
+				Msg("Denom info")
+			if unit.Denom == denom {
+				denomCoefficient = math.Pow10(int(unit.Exponent))
+				log.Info().
+					Str("denom", denom).
+					Float64("coefficient", denomCoefficient).
+					Msg("Got denom info")
+				return NewDenoms(denom, denomCoefficient, units)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("could not find the denom info of %s, try setting denom-coefficient manually", denom)
+}
+
+// registerBondDenom sets the display unit of the bond denom to the provided denom and coefficient,
+// unless it is overridden in the --denoms-config file. The coefficient must be a power of 10.
+func registerBondDenom(units map[string]DenomUnit, bondDenom, denom string, denomCoefficient float64) {
+	if _, ok := DenomOverrides[bondDenom]; ok {
+		return
+	}
+
+	exponent := math.Round(math.Log10(denomCoefficient))
+	if exponent < 0 || math.Pow10(int(exponent)) != denomCoefficient {
+		log.Warn().
+			Str("bond-denom", bondDenom).
+			Float64("coefficient", denomCoefficient).
+			Msg("The denom coefficient is not a power of 10, the amounts of the bond denom with a denom are in base units")
+		return
+	}
+
+	units[bondDenom] = DenomUnit{Display: denom, Exponent: uint32(exponent)}
+}
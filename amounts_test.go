@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// an amount of 18-exponent base units above 2^53, which float64 cannot represent exactly
+const largeAmount = "123456789123456789123456789"
+
+func TestScaleDown(t *testing.T) {
+	tests := []struct {
+		amount   string
+		exponent uint32
+		expected string
+	}{
+		{amount: "1500000", exponent: 6, expected: "1.5"},
+		{amount: "1", exponent: 6, expected: "0.000001"},
+		{amount: "1500000000000000000", exponent: 18, expected: "1.5"},
+		{amount: "1", exponent: 18, expected: "0.000000000000000001"},
+		{amount: largeAmount, exponent: 18, expected: "123456789.123456789123456789"},
+		{amount: "42", exponent: 0, expected: "42"},
+	}
+
+	for _, test := range tests {
+		scaled := ScaleDown(sdk.MustNewDecFromStr(test.amount), test.exponent)
+		if !scaled.Equal(sdk.MustNewDecFromStr(test.expected)) {
+			t.Errorf("%s scaled down by 10^%d: got %s, expected %s", test.amount, test.exponent, scaled, test.expected)
+		}
+	}
+}
+
+func TestDenomsAmount(t *testing.T) {
+	denoms, err := NewDenoms("atom", 1000000, map[string]DenomUnit{
+		"uatom":  {Display: "atom", Exponent: 6},
+		"aevmos": {Display: "evmos", Exponent: 18},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		denom        string
+		amount       string
+		value        float64
+		displayDenom string
+		display      bool
+	}{
+		{denom: "uatom", amount: "1500000", value: 1.5, displayDenom: "atom", display: true},
+		{denom: "uatom", amount: "1", value: 0.000001, displayDenom: "atom", display: true},
+		{denom: "aevmos", amount: "1500000000000000000", value: 1.5, displayDenom: "evmos", display: true},
+		{denom: "aevmos", amount: "1000000000000000001", value: 1, displayDenom: "evmos", display: true},
+		{denom: "aevmos", amount: largeAmount, value: 123456789.123456789123456789, displayDenom: "evmos", display: true},
+		{denom: "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", amount: "1500000", value: 1500000, displayDenom: "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+	}
+
+	for _, test := range tests {
+		amount, ok := sdk.NewIntFromString(test.amount)
+		if !ok {
+			t.Fatalf("invalid amount %s", test.amount)
+		}
+
+		value, displayDenom, display := denoms.Amount(test.denom, sdk.NewDecFromInt(amount))
+		if value != test.value || displayDenom != test.displayDenom || display != test.display {
+			t.Errorf(
+				"%s%s: got %v %s (display %t), expected %v %s (display %t)",
+				test.amount, test.denom,
+				value, displayDenom, display,
+				test.value, test.displayDenom, test.display,
+			)
+		}
+
+		coinValue, coinDisplayDenom, coinDisplay := denoms.CoinAmount(sdk.NewCoin(test.denom, amount))
+		if coinValue != value || coinDisplayDenom != displayDenom || coinDisplay != display {
+			t.Errorf(
+				"%s%s: got %v %s (display %t) for the coin, expected the same as the amount",
+				test.amount, test.denom,
+				coinValue, coinDisplayDenom, coinDisplay,
+			)
+		}
+	}
+}
+
+func TestDenomsBondAmount(t *testing.T) {
+	tests := []struct {
+		coefficient float64
+		amount      string
+		expected    float64
+	}{
+		{coefficient: 1000000, amount: "1500000", expected: 1.5},
+		{coefficient: 1000000, amount: "1", expected: 0.000001},
+		{coefficient: 1e18, amount: "1500000000000000000", expected: 1.5},
+		{coefficient: 1e18, amount: "1000000000000000001", expected: 1},
+		{coefficient: 1e18, amount: largeAmount, expected: 123456789.123456789123456789},
+	}
+
+	for _, test := range tests {
+		denoms, err := NewDenoms("display", test.coefficient, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		amount, ok := sdk.NewIntFromString(test.amount)
+		if !ok {
+			t.Fatalf("invalid amount %s", test.amount)
+		}
+
+		if value := denoms.BondIntAmount(amount); value != test.expected {
+			t.Errorf("%s with coefficient %v: got %v, expected %v", test.amount, test.coefficient, value, test.expected)
+		}
+
+		if value := denoms.BondAmount(sdk.NewDecFromInt(amount)); value != test.expected {
+			t.Errorf("%s with coefficient %v: got %v for the dec, expected %v", test.amount, test.coefficient, value, test.expected)
+		}
+	}
+}
+
+func TestNewDenomsInvalidCoefficient(t *testing.T) {
+	for _, coefficient := range []float64{0, -1000000} {
+		if _, err := NewDenoms("atom", coefficient, nil); err == nil {
+			t.Errorf("coefficient %v: expected an error", coefficient)
+		}
+	}
+}
+
+func TestRegisterBondDenom(t *testing.T) {
+	defer func(overrides map[string]DenomUnit) {
+		DenomOverrides = overrides
+	}(DenomOverrides)
+	DenomOverrides = map[string]DenomUnit{"uion": {Display: "ION", Exponent: 6}}
+
+	tests := []struct {
+		name        string
+		bondDenom   string
+		coefficient float64
+		expected    DenomUnit
+		registered  bool
+	}{
+		{name: "exponent 6", bondDenom: "uosmo", coefficient: 1000000, expected: DenomUnit{Display: "osmo", Exponent: 6}, registered: true},
+		{name: "exponent 18", bondDenom: "aevmos", coefficient: 1e18, expected: DenomUnit{Display: "osmo", Exponent: 18}, registered: true},
+		{name: "exponent 0", bondDenom: "uosmo", coefficient: 1, expected: DenomUnit{Display: "osmo", Exponent: 0}, registered: true},
+		{name: "not a power of 10", bondDenom: "uosmo", coefficient: 2000000},
+		{name: "overridden", bondDenom: "uion", coefficient: 1000000, expected: DenomUnit{Display: "ION", Exponent: 6}, registered: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			units := map[string]DenomUnit{}
+			for base, unit := range DenomOverrides {
+				units[base] = unit
+			}
+
+			registerBondDenom(units, test.bondDenom, "osmo", test.coefficient)
+
+			unit, registered := units[test.bondDenom]
+			if registered != test.registered || unit != test.expected {
+				t.Errorf("got %+v (registered %t), expected %+v (registered %t)", unit, registered, test.expected, test.registered)
+			}
+		})
+	}
+}
+
+// bankQueryServer serves the denoms metadata of a chain.
+type bankQueryServer struct {
+	banktypes.UnimplementedQueryServer
+
+	metadatas []banktypes.Metadata
+}
+
+func (s *bankQueryServer) DenomsMetadata(context.Context, *banktypes.QueryDenomsMetadataRequest) (*banktypes.QueryDenomsMetadataResponse, error) {
+	return &banktypes.QueryDenomsMetadataResponse{Metadatas: s.metadatas, Pagination: &querytypes.PageResponse{}}, nil
+}
+
+// stakingQueryServer serves the staking params of a chain.
+type stakingQueryServer struct {
+	stakingtypes.UnimplementedQueryServer
+
+	bondDenom string
+}
+
+func (s *stakingQueryServer) Params(context.Context, *stakingtypes.QueryParamsRequest) (*stakingtypes.QueryParamsResponse, error) {
+	return &stakingtypes.QueryParamsResponse{Params: stakingtypes.Params{BondDenom: s.bondDenom}}, nil
+}
+
+func TestFetchDenomsWithoutGrpcTimeout(t *testing.T) {
+	defer func(grpcTimeout time.Duration, maxPages int, overrides map[string]DenomUnit) {
+		GrpcTimeout, MaxPages, DenomOverrides = grpcTimeout, maxPages, overrides
+	}(GrpcTimeout, MaxPages, DenomOverrides)
+	GrpcTimeout, MaxPages, DenomOverrides = 0, 10, nil
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	banktypes.RegisterQueryServer(server, &bankQueryServer{metadatas: []banktypes.Metadata{{
+		Base:       "uatom",
+		Display:    "atom",
+		DenomUnits: []*banktypes.DenomUnit{{Denom: "uatom"}, {Denom: "atom", Exponent: 6}},
+	}}})
+	stakingtypes.RegisterQueryServer(server, &stakingQueryServer{bondDenom: "uatom"})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	grpcConn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithChainUnaryInterceptor(GrpcTimeoutInterceptor(GrpcTimeout)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpcConn.Close()
+
+	tests := []struct {
+		name        string
+		denom       string
+		coefficient float64
+	}{
+		{name: "fetched", coefficient: 0},
+		{name: "provided", denom: "atom", coefficient: 1000000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			denoms, err := fetchDenoms(grpcConn, test.denom, test.coefficient)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if denoms.Denom != "atom" || denoms.DenomCoefficient != 1000000 {
+				t.Errorf("got denom %s with coefficient %v, expected atom with coefficient 1000000", denoms.Denom, denoms.DenomCoefficient)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	distributiontypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	minttypes "github.com/cosmos/cosmos-sdk/x/mint/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"google.golang.org/grpc"
+)
+
+// mintQuery is the x/mint service, not served by the chains with a custom mint module
+const mintQuery = "cosmos.mint.v1beta1.Query"
+
+// StakingAPR is the yearly return of staking, estimated from the current inflation.
+type StakingAPR struct {
+	// BondedRatio is the bonded tokens as a fraction of the total supply of the minted denom.
+	BondedRatio sdk.Dec
+	// Nominal is the APR of a validator without commission: inflation * (1 - community tax) / bonded ratio.
+	Nominal sdk.Dec
+	// Real is the nominal APR once the dilution by the inflation is taken into account.
+	Real sdk.Dec
+}
+
+func NewStakingAPR(inflation, communityTax sdk.Dec, bondedTokens, mintSupply sdk.Int) (*StakingAPR, error) {
+	if !mintSupply.IsPositive() || !bondedTokens.IsPositive() {
+		return nil, fmt.Errorf("no supply of the minted denom or no bonded tokens")
+	}
+
+	bondedRatio := sdk.NewDecFromInt(bondedTokens).QuoInt(mintSupply)
+	nominal := inflation.Mul(sdk.OneDec().Sub(communityTax)).Quo(bondedRatio)
+
+	return &StakingAPR{
+		BondedRatio: bondedRatio,
+		Nominal:     nominal,
+		Real:        sdk.OneDec().Add(nominal).Quo(sdk.OneDec().Add(inflation)).Sub(sdk.OneDec()),
+	}, nil
+}
+
+// ValidatorAPR is the APR of the delegators of a validator with that commission rate.
+func (a *StakingAPR) ValidatorAPR(commissionRate sdk.Dec) sdk.Dec {
+	return a.Nominal.Mul(sdk.OneDec().Sub(commissionRate))
+}
+
+// StakingAPRInputs are what the staking APR is computed from.
+type StakingAPRInputs struct {
+	Inflation    sdk.Dec
+	CommunityTax sdk.Dec
+	BondedTokens sdk.Int
+	MintDenom    string
+	MintSupply   sdk.Int
+}
+
+// APR computes the staking APR, see NewStakingAPR.
+func (i *StakingAPRInputs) APR() (*StakingAPR, error) {
+	return NewStakingAPR(i.Inflation, i.CommunityTax, i.BondedTokens, i.MintSupply)
+}
+
+// FetchStakingAPR queries the inputs of the staking APR and computes it.
+// It returns nil if the chain does not have the x/mint module.
+func FetchStakingAPR(
+	ctx context.Context,
+	scrape *Scrape,
+	grpcConn *grpc.ClientConn,
+	capabilities *Capabilities,
+) (*StakingAPR, error) {
+	inputs, err := FetchStakingAPRInputs(ctx, scrape, grpcConn, capabilities)
+	if inputs == nil || err != nil {
+		return nil, err
+	}
+
+	return inputs.APR()
+}
+
+// FetchStakingAPRInputs queries the inflation, community tax, bonded tokens and supply of the minted denom.
+// It returns nil if the chain does not have the x/mint module.
+func FetchStakingAPRInputs(
+	ctx context.Context,
+	scrape *Scrape,
+	grpcConn *grpc.ClientConn,
+	capabilities *Capabilities,
+) (*StakingAPRInputs, error) {
+	if !capabilities.IsSupported(mintQuery) {
+		return nil, nil
+	}
+
+	sublogger := scrape.Logger
+	sublogger.Debug().Msg("Started querying staking APR inputs")
+	queryStart := time.Now()
+
+	mintClient := minttypes.NewQueryClient(grpcConn)
+	inflationResponse, err := mintClient.Inflation(ctx, &minttypes.QueryInflationRequest{})
+	if !capabilities.Check(mintQuery, err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not get inflation")
+		return nil, err
+	}
+
+	mintParamsResponse, err := mintClient.Params(ctx, &minttypes.QueryParamsRequest{})
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not get mint params")
+		return nil, err
+	}
+
+	distributionClient := distributiontypes.NewQueryClient(grpcConn)
+	distributionParamsResponse, err := distributionClient.Params(ctx, &distributiontypes.QueryParamsRequest{})
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not get distribution params")
+		return nil, err
+	}
+
+	stakingClient := stakingtypes.NewQueryClient(grpcConn)
+	poolResponse, err := stakingClient.Pool(ctx, &stakingtypes.QueryPoolRequest{})
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not get staking pool")
+		return nil, err
+	}
+
+	bankClient := banktypes.NewQueryClient(grpcConn)
+	supplyResponse, err := bankClient.SupplyOf(
+		ctx,
+		&banktypes.QuerySupplyOfRequest{Denom: mintParamsResponse.Params.MintDenom},
+	)
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not get supply of the minted denom")
+		return nil, err
+	}
+
+	sublogger.Debug().
+		Float64("request-time", time.Since(queryStart).Seconds()).
+		Msg("Finished querying staking APR inputs")
+
+	return &StakingAPRInputs{
+		Inflation:    inflationResponse.Inflation,
+		CommunityTax: distributionParamsResponse.Params.CommunityTax,
+		BondedTokens: poolResponse.Pool.BondedTokens,
+		MintDenom:    mintParamsResponse.Params.MintDenom,
+		MintSupply:   supplyResponse.Amount.Amount,
+	}, nil
+}
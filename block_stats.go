@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the buckets of the block interval histogram, in seconds
+var blockIntervalBuckets = []float64{1, 2, 3, 4, 5, 6, 7, 8, 10, 15, 20, 30, 60, 120}
+
+// BlockStats keeps the last block followed, the intervals between the blocks and the number of txs.
+type BlockStats struct {
+	// the histogram lives as long as the exporter, it is registered on every scrape
+	intervals prometheus.Histogram
+
+	mutex    sync.Mutex
+	last     *Block
+	txsTotal uint64
+}
+
+func NewBlockStats(constLabels map[string]string) *BlockStats {
+	return &BlockStats{
+		intervals: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:        "cosmos_block_interval_seconds",
+				Help:        "Time between two consecutive blocks, since the exporter started",
+				ConstLabels: constLabels,
+				Buckets:     blockIntervalBuckets,
+			},
+		),
+	}
+}
+
+// HandleBlock records the block. The interval is only observed if the previous block was followed.
+func (s *BlockStats) HandleBlock(block *Block) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.last != nil && block.Height == s.last.Height+1 {
+		s.intervals.Observe(block.Time.Sub(s.last.Time).Seconds())
+	}
+
+	s.last = block
+	s.txsTotal += uint64(len(block.Txs))
+}
+
+// Snapshot returns the last block followed, nil if none yet, and the number of txs of the blocks followed.
+func (s *BlockStats) Snapshot() (*Block, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.last, s.txsTotal
+}
+
+type BlocksCollector struct{}
+
+func NewBlocksCollector() *BlocksCollector {
+	return &BlocksCollector{}
+}
+
+func (c *BlocksCollector) Name() string {
+	return "blocks"
+}
+
+func (c *BlocksCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *BlocksCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	blockHeightGauge := scrape.NewGauge(
+		"cosmos_block_height",
+		"Height of the last block received",
+	)
+
+	blockTimeGauge := scrape.NewGauge(
+		"cosmos_block_time",
+		"Time of the last block received, as a Unix timestamp",
+	)
+
+	blockTxsGauge := scrape.NewGauge(
+		"cosmos_block_txs",
+		"Number of txs in the last block received",
+	)
+
+	blockTxsCounter := scrape.NewCounter(
+		"cosmos_block_txs_total",
+		"Number of txs in the blocks received since the exporter started",
+	)
+
+	blockProposerGauge := scrape.NewGaugeVec(
+		"cosmos_block_proposer",
+		"Proposer of the last block received, by hex address of its consensus key",
+		"address",
+	)
+
+	resubscriptionsCounter := scrape.NewCounter(
+		"cosmos_block_subscription_resubscriptions_total",
+		"Times the exporter subscribed again to the new blocks after the subscription failed or stalled",
+	)
+
+	backfilledBlocksCounter := scrape.NewCounter(
+		"cosmos_block_subscription_backfilled_blocks_total",
+		"Blocks missed by the subscription and fetched afterwards",
+	)
+
+	validatorSetUpdatesCounter := scrape.NewCounter(
+		"cosmos_block_validator_set_updates_total",
+		"Validator set updates received since the exporter started",
+	)
+
+	blockStats := scrape.Chain.BlockStats()
+	scrape.Registry.MustRegister(blockStats.intervals)
+
+	followerStats := scrape.Chain.Blocks().Stats()
+	resubscriptionsCounter.Add(float64(followerStats.Resubscriptions))
+	backfilledBlocksCounter.Add(float64(followerStats.BackfilledBlocks))
+	validatorSetUpdatesCounter.Add(float64(followerStats.ValidatorSetUpdates))
+
+	block, txsTotal := blockStats.Snapshot()
+	if block == nil {
+		sublogger.Debug().Msg("No block received yet")
+		return nil
+	}
+
+	blockHeightGauge.Set(float64(block.Height))
+	blockTimeGauge.Set(float64(block.Time.Unix()))
+	blockTxsGauge.Set(float64(len(block.Txs)))
+	blockTxsCounter.Add(float64(txsTotal))
+	blockProposerGauge.With(prometheus.Labels{"address": block.ProposerAddress}).Set(1)
+
+	return nil
+}
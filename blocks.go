@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	tmrpc "github.com/tendermint/tendermint/rpc/client/http"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// validators per page of the Tendermint RPC /validators endpoint, which is its maximum
+const validatorsPerPage = 100
+
+// the subscriber the events are subscribed with, Tendermint limits the subscriptions per subscriber
+const eventsSubscriber = "cosmos-exporter"
+
+// the events received while the previous ones are handled, the next ones are dropped and backfilled
+const eventsCapacity = 100
+
+// the delay before subscribing again, doubled on every failure
+const (
+	minResubscribeDelay = time.Second
+	maxResubscribeDelay = time.Minute
+)
+
+// BlockValidator is a validator of the set of a block, with its vote on it.
+type BlockValidator struct {
+	// Address is the hex address of the consensus key of the validator, as in Tendermint RPC.
+	Address     string
+	VotingPower int64
+	Signed      bool
+}
+
+// Commit is the commit of a block, with the votes of all the validators of its set, in the order of the set.
+type Commit struct {
+	Height     int64
+	Round      int
+	Validators []BlockValidator
+}
+
+// Block is a new block, with the commit of the previous one it includes.
+type Block struct {
+	Height          int64
+	Time            time.Time
+	ProposerAddress string
+	Txs             [][]byte
+	// LastCommit is nil for the first block of the chain.
+	LastCommit *Commit
+}
+
+// BlockHandler is called with every block the BlockFollower follows, in order of height.
+type BlockHandler func(block *Block)
+
+// BlockFollowerStats is how the BlockFollower has been following the blocks since the exporter started.
+type BlockFollowerStats struct {
+	Height              int64
+	Resubscriptions     uint64
+	BackfilledBlocks    uint64
+	ValidatorSetUpdates uint64
+}
+
+// BlockFollower subscribes to the new blocks of a chain via the Tendermint RPC websocket and passes them
+// to its handlers. It subscribes again on another upstream when the subscription fails or stalls,
+// and fetches the blocks it missed meanwhile from /block, up to maxBehind blocks.
+type BlockFollower struct {
+	chain     *Chain
+	maxBehind int64
+
+	mutex    sync.Mutex
+	handlers []BlockHandler
+	stats    BlockFollowerStats
+	// the hash of the validator set of the last block followed, which signs the commit of the next one
+	lastValidatorsHash string
+
+	// the validator set only changes from time to time, it is fetched again only when its hash changes
+	validatorsHash string
+	validators     []BlockValidator
+}
+
+func NewBlockFollower(chain *Chain, maxBehind int64) *BlockFollower {
+	return &BlockFollower{chain: chain, maxBehind: maxBehind}
+}
+
+// Subscribe adds a handler, which is called with the next blocks.
+func (f *BlockFollower) Subscribe(handler BlockHandler) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.handlers = append(f.handlers, handler)
+}
+
+// Height returns the height of the last block followed.
+func (f *BlockFollower) Height() int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.stats.Height
+}
+
+// Stats returns the height of the last block followed and how the blocks were followed.
+func (f *BlockFollower) Stats() BlockFollowerStats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.stats
+}
+
+// Run follows the new blocks, subscribing again every time the subscription ends.
+func (f *BlockFollower) Run() {
+	delay := minResubscribeDelay
+
+	for {
+		upstream := f.chain.Upstreams.Pick()
+		subscribed := time.Now()
+
+		err := f.follow(upstream)
+		log.Warn().
+			Str("chain", f.chain.Name).
+			Str("upstream", upstream.Name()).
+			Err(err).
+			Dur("delay", delay).
+			Msg("Block subscription ended, subscribing again")
+
+		// the delay is only increased when the subscriptions fail right away
+		if time.Since(subscribed) > maxResubscribeDelay {
+			delay = minResubscribeDelay
+		}
+
+		time.Sleep(delay)
+
+		if delay *= 2; delay > maxResubscribeDelay {
+			delay = maxResubscribeDelay
+		}
+
+		f.mutex.Lock()
+		f.stats.Resubscriptions++
+		f.mutex.Unlock()
+	}
+}
+
+// follow subscribes to the new blocks and validator set updates of the upstream and handles them,
+// until the subscription fails or no block is received for BlockStallTimeout.
+func (f *BlockFollower) follow(upstream *Upstream) error {
+	client, err := tmrpc.NewWithClient(upstream.TendermintRPC, "/websocket", f.chain.HTTPClient)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Start(); err != nil {
+		return fmt.Errorf("could not connect to the websocket: %w", err)
+	}
+
+	defer func() {
+		_ = client.Stop()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), TendermintRPCTimeout)
+	defer cancel()
+
+	newBlocks, err := client.Subscribe(ctx, eventsSubscriber, tmtypes.EventQueryNewBlock.String(), eventsCapacity)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to the new blocks: %w", err)
+	}
+
+	validatorSetUpdates, err := client.Subscribe(
+		ctx,
+		eventsSubscriber,
+		tmtypes.EventQueryValidatorSetUpdates.String(),
+		eventsCapacity,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to the validator set updates: %w", err)
+	}
+
+	log.Info().
+		Str("chain", f.chain.Name).
+		Str("upstream", upstream.Name()).
+		Msg("Subscribed to the new blocks")
+
+	stall := time.NewTimer(BlockStallTimeout)
+	defer stall.Stop()
+
+	for {
+		select {
+		case event := <-newBlocks:
+			data, ok := event.Data.(tmtypes.EventDataNewBlock)
+			if !ok || data.Block == nil {
+				continue
+			}
+
+			if err := f.handleNewBlock(client, data.Block); err != nil {
+				return err
+			}
+
+			if !stall.Stop() {
+				<-stall.C
+			}
+			stall.Reset(BlockStallTimeout)
+		case event := <-validatorSetUpdates:
+			data, ok := event.Data.(tmtypes.EventDataValidatorSetUpdates)
+			if !ok {
+				continue
+			}
+
+			log.Info().
+				Str("chain", f.chain.Name).
+				Int("updates", len(data.ValidatorUpdates)).
+				Msg("Validator set updated")
+
+			f.mutex.Lock()
+			f.stats.ValidatorSetUpdates++
+			f.mutex.Unlock()
+		case <-stall.C:
+			return fmt.Errorf("no new block for %s", BlockStallTimeout)
+		}
+	}
+}
+
+// handleNewBlock fetches the blocks missed since the last one followed, then handles the new block.
+func (f *BlockFollower) handleNewBlock(client *tmrpc.HTTP, newBlock *tmtypes.Block) error {
+	height := f.Height()
+
+	// the last blocks can be sent again once subscribed again
+	if newBlock.Height <= height {
+		return nil
+	}
+
+	if height != 0 && newBlock.Height-height > 1 {
+		from := height + 1
+		if newBlock.Height-from > f.maxBehind {
+			log.Warn().
+				Str("chain", f.chain.Name).
+				Int64("from", from).
+				Int64("to", newBlock.Height-f.maxBehind-1).
+				Msg("Too far behind, skipping blocks")
+			from = newBlock.Height - f.maxBehind
+		}
+
+		for missedHeight := from; missedHeight < newBlock.Height; missedHeight++ {
+			missedHeight := missedHeight
+
+			ctx, cancel := context.WithTimeout(context.Background(), TendermintRPCTimeout)
+			blockResponse, err := client.Block(ctx, &missedHeight)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("could not get missed block %d: %w", missedHeight, err)
+			}
+
+			if err := f.handleBlock(client, blockResponse.Block); err != nil {
+				return err
+			}
+
+			f.mutex.Lock()
+			f.stats.BackfilledBlocks++
+			f.mutex.Unlock()
+		}
+	}
+
+	return f.handleBlock(client, newBlock)
+}
+
+func (f *BlockFollower) handleBlock(client *tmrpc.HTTP, tmBlock *tmtypes.Block) error {
+	block := &Block{
+		Height:          tmBlock.Height,
+		Time:            tmBlock.Time,
+		ProposerAddress: tmBlock.ProposerAddress.String(),
+		Txs:             make([][]byte, len(tmBlock.Txs)),
+	}
+
+	for index, tx := range tmBlock.Txs {
+		block.Txs[index] = tx
+	}
+
+	if tmBlock.LastCommit != nil && tmBlock.LastCommit.Height > 0 {
+		// the hash of the validator set of the previous block is only known if it was followed
+		var validatorsHash string
+
+		f.mutex.Lock()
+		if f.stats.Height == tmBlock.Height-1 {
+			validatorsHash = f.lastValidatorsHash
+		}
+		f.mutex.Unlock()
+
+		commit, err := f.commit(client, tmBlock.LastCommit, validatorsHash)
+		if err != nil {
+			return err
+		}
+
+		block.LastCommit = commit
+	}
+
+	f.mutex.Lock()
+	handlers := f.handlers
+	f.stats.Height = block.Height
+	f.lastValidatorsHash = tmBlock.ValidatorsHash.String()
+	f.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(block)
+	}
+
+	return nil
+}
+
+// commit matches the signatures of a commit with the validator set of its block.
+func (f *BlockFollower) commit(client *tmrpc.HTTP, tmCommit *tmtypes.Commit, validatorsHash string) (*Commit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TendermintRPCTimeout)
+	defer cancel()
+
+	validators, err := f.validatorSet(ctx, client, tmCommit.Height, validatorsHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signatures are in the order of the validator set, the absent ones have no address
+	if len(validators) != len(tmCommit.Signatures) {
+		return nil, fmt.Errorf(
+			"got %d signatures for %d validators at height %d",
+			len(tmCommit.Signatures),
+			len(validators),
+			tmCommit.Height,
+		)
+	}
+
+	commit := &Commit{
+		Height:     tmCommit.Height,
+		Round:      int(tmCommit.Round),
+		Validators: make([]BlockValidator, len(validators)),
+	}
+
+	for index, validator := range validators {
+		validator.Signed = tmCommit.Signatures[index].BlockIDFlag == tmtypes.BlockIDFlagCommit
+		commit.Validators[index] = validator
+	}
+
+	return commit, nil
+}
+
+// validatorSet returns the validator set of the block. The set is fetched again if its hash is not known.
+func (f *BlockFollower) validatorSet(
+	ctx context.Context,
+	client *tmrpc.HTTP,
+	height int64,
+	validatorsHash string,
+) ([]BlockValidator, error) {
+	f.mutex.Lock()
+	if validatorsHash != "" && validatorsHash == f.validatorsHash {
+		validators := f.validators
+		f.mutex.Unlock()
+		return validators, nil
+	}
+	f.mutex.Unlock()
+
+	var validators []BlockValidator
+
+	perPage := validatorsPerPage
+	for page := 1; ; page++ {
+		page := page
+
+		validatorsResponse, err := client.Validators(ctx, &height, &page, &perPage)
+		if err != nil {
+			return nil, fmt.Errorf("could not get the validators at height %d: %w", height, err)
+		}
+
+		for _, validator := range validatorsResponse.Validators {
+			validators = append(validators, BlockValidator{
+				Address:     validator.Address.String(),
+				VotingPower: validator.VotingPower,
+			})
+		}
+
+		if len(validators) >= validatorsResponse.Total || len(validatorsResponse.Validators) == 0 {
+			break
+		}
+	}
+
+	if validatorsHash != "" {
+		f.mutex.Lock()
+		f.validatorsHash, f.validators = validatorsHash, validators
+		f.mutex.Unlock()
+	}
+
+	return validators, nil
+}
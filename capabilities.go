@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Capabilities remembers the gRPC queries a chain does not serve, e.g. the x/mint queries
+// on the chains with a custom mint module, so they are not sent again on every scrape.
+type Capabilities struct {
+	mutex       sync.RWMutex
+	unsupported map[string]bool
+}
+
+func NewCapabilities() *Capabilities {
+	return &Capabilities{unsupported: make(map[string]bool)}
+}
+
+// IsSupported returns false if the query was found not to be served by the chain.
+func (c *Capabilities) IsSupported(query string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return !c.unsupported[query]
+}
+
+// Check returns false and marks the query as not supported if the error says the node does not serve it.
+// The query is considered supported otherwise, even if it failed for another reason.
+func (c *Capabilities) Check(query string, err error) bool {
+	if status.Code(err) != codes.Unimplemented {
+		return true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.unsupported[query] {
+		log.Info().
+			Str("query", query).
+			Err(err).
+			Msg("Query not supported by the chain, not querying it anymore")
+		c.unsupported[query] = true
+	}
+
+	return false
+}
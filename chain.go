@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+)
+
+// ChainConfig is a chain to monitor, as listed in the "chains" section of the config file.
+// Empty bech32 prefixes are derived from BechPrefix the same way the flags are.
+type ChainConfig struct {
+	Name             string   `mapstructure:"name"`
+	Nodes            []string `mapstructure:"node"`
+	TendermintRPCs   []string `mapstructure:"tendermint-rpc"`
+	ReferenceRPC     string   `mapstructure:"reference-tendermint-rpc"`
+	RoundRobin       bool     `mapstructure:"round-robin"`
+	Denom            string   `mapstructure:"denom"`
+	DenomCoefficient float64  `mapstructure:"denom-coefficient"`
+
+	BechPrefix                string `mapstructure:"bech-prefix"`
+	AccountPrefix             string `mapstructure:"bech-account-prefix"`
+	AccountPubkeyPrefix       string `mapstructure:"bech-account-pubkey-prefix"`
+	ValidatorPrefix           string `mapstructure:"bech-validator-prefix"`
+	ValidatorPubkeyPrefix     string `mapstructure:"bech-validator-pubkey-prefix"`
+	ConsensusNodePrefix       string `mapstructure:"bech-consensus-node-prefix"`
+	ConsensusNodePubkeyPrefix string `mapstructure:"bech-consensus-node-pubkey-prefix"`
+}
+
+func (config *ChainConfig) setBechPrefixes() {
+	if config.AccountPrefix == "" {
+		config.AccountPrefix = config.BechPrefix
+	}
+
+	if config.AccountPubkeyPrefix == "" {
+		config.AccountPubkeyPrefix = config.BechPrefix + "pub"
+	}
+
+	if config.ValidatorPrefix == "" {
+		config.ValidatorPrefix = config.BechPrefix + "valoper"
+	}
+
+	if config.ValidatorPubkeyPrefix == "" {
+		config.ValidatorPubkeyPrefix = config.BechPrefix + "valoperpub"
+	}
+
+	if config.ConsensusNodePrefix == "" {
+		config.ConsensusNodePrefix = config.BechPrefix + "valcons"
+	}
+
+	if config.ConsensusNodePubkeyPrefix == "" {
+		config.ConsensusNodePubkeyPrefix = config.BechPrefix + "valconspub"
+	}
+}
+
+// Chain holds everything the collectors need to know about the network they are querying.
+type Chain struct {
+	ChainConfig
+
+	ChainID      string
+	ConstLabels  map[string]string
+	Upstreams    *UpstreamPool
+	Denoms       *Denoms
+	DenomTraces  *DenomTraces
+	Capabilities *Capabilities
+	HTTPClient   *http.Client
+
+	blocksOnce       sync.Once
+	blocks           *BlockFollower
+	blockStatsOnce   sync.Once
+	blockStats       *BlockStats
+	signingOnce      sync.Once
+	signing          *SigningTracker
+	proposersOnce    sync.Once
+	proposers        *ProposerTracker
+	txsOnce          sync.Once
+	txs              *TxTracker
+	validatorSetOnce sync.Once
+	validatorSet     *ValidatorSetTracker
+}
+
+// NewChain connects to the nodes of the chain, fetches its chain ID and denoms
+// and starts checking the health of the nodes.
+func NewChain(config ChainConfig, metrics *ExporterMetrics) (*Chain, error) {
+	config.setBechPrefixes()
+
+	chain := &Chain{
+		ChainConfig:  config,
+		Capabilities: NewCapabilities(),
+		HTTPClient:   &http.Client{Timeout: TendermintRPCTimeout},
+	}
+
+	if err := chain.setChainID(); err != nil {
+		return nil, err
+	}
+
+	if chain.Name == "" {
+		chain.Name = chain.ChainID
+	}
+
+	chain.ConstLabels = map[string]string{
+		"chain_id": chain.ChainID,
+	}
+
+	upstreams, err := NewUpstreamPool(chain.Name, chain.Nodes, chain.TendermintRPCs, chain.RoundRobin, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TendermintRPCTimeout)
+	upstreams.Check(ctx)
+	cancel()
+
+	chain.Upstreams = upstreams
+
+	denoms, err := fetchDenoms(upstreams.Pick().GrpcConn, chain.Denom, chain.DenomCoefficient)
+	if err != nil {
+		return nil, err
+	}
+
+	chain.Denoms = denoms
+	chain.DenomTraces = NewDenomTraces()
+
+	go upstreams.Run(HealthCheckInterval)
+
+	return chain, nil
+}
+
+// Blocks returns the follower of the new blocks of the chain. It is started on first use,
+// so the new blocks are only subscribed to if a collector needs them.
+func (c *Chain) Blocks() *BlockFollower {
+	c.blocksOnce.Do(func() {
+		c.blocks = NewBlockFollower(c, int64(SigningWindow))
+		go c.blocks.Run()
+	})
+
+	return c.blocks
+}
+
+// BlockStats returns the stats of the new blocks of the chain, started on first use.
+func (c *Chain) BlockStats() *BlockStats {
+	c.blockStatsOnce.Do(func() {
+		c.blockStats = NewBlockStats(c.ConstLabels)
+		c.Blocks().Subscribe(c.blockStats.HandleBlock)
+	})
+
+	return c.blockStats
+}
+
+// Signing returns the tracker of the blocks signed by the validators, started on first use.
+func (c *Chain) Signing() *SigningTracker {
+	c.signingOnce.Do(func() {
+		c.signing = NewSigningTracker(SigningWindow)
+		c.Blocks().Subscribe(c.signing.HandleBlock)
+	})
+
+	return c.signing
+}
+
+// Proposers returns the tracker of the blocks proposed by the validators, started on first use.
+func (c *Chain) Proposers() *ProposerTracker {
+	c.proposersOnce.Do(func() {
+		c.proposers = NewProposerTracker()
+		c.Blocks().Subscribe(c.proposers.HandleBlock)
+	})
+
+	return c.proposers
+}
+
+// Txs returns the tracker of the txs of the blocks, started on first use.
+func (c *Chain) Txs() *TxTracker {
+	c.txsOnce.Do(func() {
+		c.txs = NewTxTracker(c)
+		c.Blocks().Subscribe(c.txs.HandleBlock)
+	})
+
+	return c.txs
+}
+
+// ValidatorSet returns the tracker of the changes of the validator set, started on first use.
+func (c *Chain) ValidatorSet() *ValidatorSetTracker {
+	c.validatorSetOnce.Do(func() {
+		c.validatorSet = NewValidatorSetTracker(c)
+		c.Blocks().Subscribe(c.validatorSet.HandleBlock)
+	})
+
+	return c.validatorSet
+}
+
+// setChainID fetches the chain ID from the first node answering.
+func (c *Chain) setChainID() error {
+	var err error
+
+	for _, tendermintRPC := range c.TendermintRPCs {
+		var body []byte
+
+		ctx, cancel := context.WithTimeout(context.Background(), TendermintRPCTimeout)
+		body, err = HTTPGet(ctx, c.HTTPClient, tendermintRPC+"/status")
+		cancel()
+		if err != nil {
+			log.Warn().Str("tendermint-rpc", tendermintRPC).Err(err).Msg("Could not query Tendermint status")
+			continue
+		}
+
+		statusResponse := StatusResponse{}
+		if err = json.Unmarshal(body, &statusResponse); err != nil {
+			log.Warn().Str("tendermint-rpc", tendermintRPC).Err(err).Msg("Error unmarshalling the status json response")
+			continue
+		}
+
+		log.Info().Str("network", statusResponse.Result.NodeInfo.Network).Msg("Got network status from Tendermint")
+		c.ChainID = statusResponse.Result.NodeInfo.Network
+		return nil
+	}
+
+	return fmt.Errorf("could not query Tendermint status: %w", err)
+}
+
+// AccAddress checks the account address belongs to the chain and returns it normalized.
+// The global SDK config is not used, as it can only hold the prefixes of a single chain.
+func (c *Chain) AccAddress(address string) (string, error) {
+	return normalizeBech32(address, c.AccountPrefix)
+}
+
+// ValAddress checks the validator address belongs to the chain and returns it normalized.
+func (c *Chain) ValAddress(address string) (string, error) {
+	return normalizeBech32(address, c.ValidatorPrefix)
+}
+
+// ValidatorAccAddress returns the account address of the operator of a validator, the one it votes with.
+func (c *Chain) ValidatorAccAddress(validatorAddress string) (string, error) {
+	bz, err := sdk.GetFromBech32(validatorAddress, c.ValidatorPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	return bech32.ConvertAndEncode(c.AccountPrefix, bz)
+}
+
+// ConsAddress encodes a consensus address with the prefix of the chain.
+func (c *Chain) ConsAddress(address sdk.ConsAddress) (string, error) {
+	return bech32.ConvertAndEncode(c.ConsensusNodePrefix, address)
+}
+
+func normalizeBech32(address, prefix string) (string, error) {
+	bz, err := sdk.GetFromBech32(address, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	if err := sdk.VerifyAddressFormat(bz); err != nil {
+		return "", err
+	}
+
+	return bech32.ConvertAndEncode(prefix, bz)
+}
+
+// Chains are the chains the exporter is monitoring, by name.
+type Chains struct {
+	list   []*Chain
+	byName map[string]*Chain
+}
+
+func NewChains(chains []*Chain) (*Chains, error) {
+	byName := make(map[string]*Chain, len(chains))
+	for _, chain := range chains {
+		if _, ok := byName[chain.Name]; ok {
+			return nil, fmt.Errorf("chain %q is configured twice", chain.Name)
+		}
+
+		byName[chain.Name] = chain
+	}
+
+	return &Chains{list: chains, byName: byName}, nil
+}
+
+// Get returns the chain with that name. The name can be omitted if only a single chain is monitored.
+func (c *Chains) Get(name string) (*Chain, error) {
+	if name == "" {
+		if len(c.list) == 1 {
+			return c.list[0], nil
+		}
+
+		return nil, fmt.Errorf("several chains are configured, the chain query param is required")
+	}
+
+	chain, ok := c.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown chain %q", name)
+	}
+
+	return chain, nil
+}
+
+func (c *Chains) List() []*Chain {
+	return c.list
+}
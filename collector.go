@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// Collector is a module exposing its metrics on /metrics/<name>.
+type Collector interface {
+	// Name is used both for the route and to enable the collector in the config.
+	Name() string
+	// RequiredParams lists the query params the scrape is rejected without.
+	RequiredParams() []string
+	// Collect describes the metrics of the collector on the scrape and fills them.
+	// It returns an InvalidParamError if the query params are malformed,
+	// or any other error if the metrics could only be filled partially.
+	Collect(ctx context.Context, scrape *Scrape) error
+}
+
+// NewCollectors returns every collector the exporter knows about, in the order they are mounted.
+func NewCollectors(networks Networks) []Collector {
+	return []Collector{
+		NewWalletCollector(networks),
+		NewValidatorCollector(),
+		NewValidatorsCollector(),
+		NewParamsCollector(),
+		NewGovCollector(),
+		NewGeneralCollector(),
+		NewGravityBridgeWalletCollector(),
+		NewGravityBridgeContractCollector(),
+		NewStatusCollector(),
+		NewConsensusCollector(),
+		NewMempoolCollector(),
+		NewSigningCollector(),
+		NewProposersCollector(),
+		NewValidatorSetCollector(),
+		NewBlocksCollector(),
+		NewTxsCollector(),
+		NewOsmosisCollector(),
+	}
+}
+
+// EnabledCollectors filters the collectors by name. All of them are enabled if names is empty.
+func EnabledCollectors(collectors []Collector, names []string) ([]Collector, error) {
+	if len(names) == 0 {
+		return collectors, nil
+	}
+
+	byName := make(map[string]Collector, len(collectors))
+	for _, collector := range collectors {
+		byName[collector.Name()] = collector
+	}
+
+	enabled := make([]Collector, 0, len(names))
+	for _, name := range names {
+		collector, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+
+		enabled = append(enabled, collector)
+	}
+
+	return enabled, nil
+}
+
+// InvalidParamError is returned by a collector if a query param could not be parsed.
+type InvalidParamError struct {
+	Param string
+	Err   error
+}
+
+func (e *InvalidParamError) Error() string {
+	return fmt.Sprintf("invalid %s param: %s", e.Param, e.Err)
+}
+
+func (e *InvalidParamError) Unwrap() error {
+	return e.Err
+}
+
+// Scrape holds the state of a single collection: the chain, the node queried and the query params,
+// the registry the metrics are registered in and the queries running concurrently.
+type Scrape struct {
+	Chain    *Chain
+	Upstream *Upstream
+	Params   url.Values
+	Logger   *zerolog.Logger
+	Registry *prometheus.Registry
+
+	wg       sync.WaitGroup
+	errors   QueryErrors
+	timeouts int32
+
+	mutex sync.Mutex
+	pages map[string]int
+}
+
+func NewScrape(chain *Chain, params url.Values, sublogger *zerolog.Logger) *Scrape {
+	return &Scrape{
+		Chain:    chain,
+		Upstream: chain.Upstreams.Pick(),
+		Params:   params,
+		Logger:   sublogger,
+		Registry: prometheus.NewRegistry(),
+		pages:    map[string]int{},
+	}
+}
+
+// NewGauge creates a gauge with the chain labels and registers it.
+func (s *Scrape) NewGauge(name, help string) prometheus.Gauge {
+	gauge := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        name,
+			Help:        help,
+			ConstLabels: s.Chain.ConstLabels,
+		},
+	)
+
+	s.Registry.MustRegister(gauge)
+	return gauge
+}
+
+// NewGaugeVec creates a gauge vector with the chain labels and registers it.
+func (s *Scrape) NewGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        name,
+			Help:        help,
+			ConstLabels: s.Chain.ConstLabels,
+		},
+		labels,
+	)
+
+	s.Registry.MustRegister(gauge)
+	return gauge
+}
+
+// NewCounterVec creates a counter vector with the chain labels and registers it.
+// The collectors add the totals they keep track of to it.
+func (s *Scrape) NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        name,
+			Help:        help,
+			ConstLabels: s.Chain.ConstLabels,
+		},
+		labels,
+	)
+
+	s.Registry.MustRegister(counter)
+	return counter
+}
+
+// NewCounter creates a counter with the chain labels and registers it.
+func (s *Scrape) NewCounter(name, help string) prometheus.Counter {
+	counter := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:        name,
+			Help:        help,
+			ConstLabels: s.Chain.ConstLabels,
+		},
+	)
+
+	s.Registry.MustRegister(counter)
+	return counter
+}
+
+// Go runs a query concurrently. The returned error marks the scrape as partially failed.
+func (s *Scrape) Go(query func() error) {
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		if err := query(); err != nil {
+			s.errors.Add(err)
+
+			if IsTimeout(err) {
+				atomic.AddInt32(&s.timeouts, 1)
+			}
+		}
+	}()
+}
+
+// Timeouts returns the number of queries that failed because they timed out.
+func (s *Scrape) Timeouts() int {
+	return int(atomic.LoadInt32(&s.timeouts))
+}
+
+// Wait waits for all the queries to finish and returns an error if any of them failed.
+func (s *Scrape) Wait() error {
+	s.wg.Wait()
+	return s.errors.Err()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/simapp"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the votes bit array of a round, e.g. "BA{4:xx_x} 30/40 = 0.75": the validators which voted
+// by index in the set, and the voting power which voted over the total voting power
+var voteBitArrayRegexp = regexp.MustCompile(`^BA\{(\d+):([x_]*)\} (\d+)/(\d+) = `)
+
+// the length of the fingerprint of the validator address in the votes, 6 bytes in hex
+const voteFingerprintLength = 12
+
+// VoteBitArray is the votes of a round, parsed from the bit array of the consensus state.
+type VoteBitArray struct {
+	// Validators is the size of the validator set, Voted is the number of validators which voted.
+	Validators int
+	Voted      int
+	// VotedPower is the voting power which voted, TotalPower is the voting power of the set.
+	VotedPower int64
+	TotalPower int64
+}
+
+func ParseVoteBitArray(bitArray string) (*VoteBitArray, error) {
+	matches := voteBitArrayRegexp.FindStringSubmatch(bitArray)
+	if matches == nil {
+		return nil, fmt.Errorf("could not parse the votes bit array %q", bitArray)
+	}
+
+	validators, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return nil, err
+	}
+
+	votedPower, err := strconv.ParseInt(matches[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPower, err := strconv.ParseInt(matches[4], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VoteBitArray{
+		Validators: validators,
+		Voted:      strings.Count(matches[2], "x"),
+		VotedPower: votedPower,
+		TotalPower: totalPower,
+	}, nil
+}
+
+// ParseHeightRoundStep parses the "height/round/step" of the consensus state.
+func ParseHeightRoundStep(heightRoundStep string) (int64, int, int, error) {
+	parts := strings.Split(heightRoundStep, "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("could not parse the height/round/step %q", heightRoundStep)
+	}
+
+	height, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	round, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	step, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return height, round, step, nil
+}
+
+// hasVoted returns whether the votes of a round include a vote of the validator, for a block or for nil.
+// The votes only show the first bytes of the address of the validator, e.g. "Vote{2:0A1B2C3D4E5F 10/00/...}".
+func hasVoted(votes []string, address string) bool {
+	if len(address) < voteFingerprintLength {
+		return false
+	}
+
+	fingerprint := ":" + strings.ToUpper(address[:voteFingerprintLength]) + " "
+	for _, vote := range votes {
+		if strings.HasPrefix(vote, "Vote{") && strings.Contains(vote, fingerprint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ConsensusCollector struct{}
+
+func NewConsensusCollector() *ConsensusCollector {
+	return &ConsensusCollector{}
+}
+
+func (c *ConsensusCollector) Name() string {
+	return "consensus"
+}
+
+func (c *ConsensusCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *ConsensusCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	heightGauge := scrape.NewGauge(
+		"cosmos_consensus_height",
+		"Height the node is reaching consensus on",
+	)
+
+	roundGauge := scrape.NewGauge(
+		"cosmos_consensus_round",
+		"Round of the height the node is in, above 0 if the first rounds failed",
+	)
+
+	stepGauge := scrape.NewGauge(
+		"cosmos_consensus_step",
+		"Step of the round the node is in: 1 NewHeight, 2 NewRound, 3 Propose, 4 Prevote, 5 PrevoteWait, 6 Precommit, 7 PrecommitWait, 8 Commit",
+	)
+
+	timeSinceStartGauge := scrape.NewGauge(
+		"cosmos_consensus_time_since_start_seconds",
+		"Time since the start time of the round state, growing with every round a height is stuck for",
+	)
+
+	votesPowerRatioGauge := scrape.NewGaugeVec(
+		"cosmos_consensus_votes_power_ratio",
+		"Fraction of the voting power which voted in the round of the current height",
+		"round", "type",
+	)
+
+	votesGauge := scrape.NewGaugeVec(
+		"cosmos_consensus_votes",
+		"Number of validators which voted in the round of the current height",
+		"round", "type",
+	)
+
+	proposerGauge := scrape.NewGaugeVec(
+		"cosmos_consensus_proposer",
+		"Proposer of the current round, by hex address of its consensus key",
+		"address",
+	)
+
+	validatorVotedGauge := scrape.NewGaugeVec(
+		"cosmos_consensus_validator_voted",
+		"Whether the validator voted in the current round, 1 if it did, 0 if it did not",
+		"address", "cons_address", "type",
+	)
+
+	// the validator is the one of the address param if set, the one of the node otherwise.
+	// The validator of the node is only known by the hex address of its consensus key, its valoper address is left empty.
+	var validatorAddress, validatorConsAddress string
+	if address := scrape.Params.Get("address"); address != "" {
+		var err error
+		validatorAddress, err = scrape.Chain.ValAddress(address)
+		if err != nil {
+			return &InvalidParamError{Param: "address", Err: err}
+		}
+
+		scrape.Go(func() error {
+			sublogger.Debug().
+				Str("address", validatorAddress).
+				Msg("Started querying validator")
+			queryStart := time.Now()
+
+			stakingClient := stakingtypes.NewQueryClient(scrape.Upstream.GrpcConn)
+			validatorResponse, err := stakingClient.Validator(
+				ctx,
+				&stakingtypes.QueryValidatorRequest{ValidatorAddr: validatorAddress},
+			)
+			if err != nil {
+				sublogger.Error().
+					Str("address", validatorAddress).
+					Err(err).
+					Msg("Could not get validator")
+				return err
+			}
+
+			sublogger.Debug().
+				Str("address", validatorAddress).
+				Float64("request-time", time.Since(queryStart).Seconds()).
+				Msg("Finished querying validator")
+
+			interfaceRegistry := simapp.MakeTestEncodingConfig().InterfaceRegistry
+			if err := validatorResponse.Validator.UnpackInterfaces(interfaceRegistry); err != nil {
+				sublogger.Error().
+					Str("address", validatorAddress).
+					Err(err).
+					Msg("Could not unpack validator interfaces")
+				return err
+			}
+
+			consAddress, err := validatorResponse.Validator.GetConsAddr()
+			if err != nil {
+				sublogger.Error().
+					Str("address", validatorAddress).
+					Err(err).
+					Msg("Could not get validator pubkey")
+				return err
+			}
+
+			validatorConsAddress = strings.ToUpper(hex.EncodeToString(consAddress))
+			return nil
+		})
+	} else {
+		scrape.Go(func() error {
+			body, err := HTTPGet(ctx, scrape.Chain.HTTPClient, scrape.Upstream.TendermintRPC+"/status")
+			if err != nil {
+				sublogger.Error().Err(err).Msg("Error getting the status")
+				return err
+			}
+
+			statusResponse := StatusResponse{}
+			if err := json.Unmarshal(body, &statusResponse); err != nil {
+				sublogger.Error().Err(err).Msg("Error unmarshalling the status json response")
+				return err
+			}
+
+			// the node is not a validator if its key has no voting power
+			if votingPower := statusResponse.Result.ValidatorInfo.VotingPower; votingPower != "" && votingPower != "0" {
+				validatorConsAddress = statusResponse.Result.ValidatorInfo.Address
+			}
+
+			return nil
+		})
+	}
+
+	var consensusStateResponse ConsensusStateResponse
+
+	scrape.Go(func() error {
+		sublogger.Debug().Msg("Started querying consensus state")
+		queryStart := time.Now()
+
+		body, err := HTTPGet(ctx, scrape.Chain.HTTPClient, scrape.Upstream.TendermintRPC+"/consensus_state")
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Error getting the consensus_state")
+			return err
+		}
+
+		if err := json.Unmarshal(body, &consensusStateResponse); err != nil {
+			sublogger.Error().Err(err).Msg("Error unmarshalling the consensus_state json response")
+			return err
+		}
+
+		sublogger.Debug().
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying consensus state")
+		return nil
+	})
+
+	// the votes of the validator are left out if it could not be fetched
+	_ = scrape.Wait()
+
+	roundState := consensusStateResponse.Result.RoundState
+	if roundState.HeightRoundStep == "" {
+		return scrape.Wait()
+	}
+
+	height, round, step, err := ParseHeightRoundStep(roundState.HeightRoundStep)
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not parse the consensus state")
+		return err
+	}
+
+	heightGauge.Set(float64(height))
+	roundGauge.Set(float64(round))
+	stepGauge.Set(float64(step))
+	timeSinceStartGauge.Set(time.Since(roundState.StartTime).Seconds())
+
+	if roundState.Proposer.Address != "" {
+		proposerGauge.With(prometheus.Labels{"address": roundState.Proposer.Address}).Set(1)
+	}
+
+	for _, roundVotes := range roundState.HeightVoteSet {
+		votes := map[string]struct {
+			bitArray string
+			votes    []string
+		}{
+			"prevote":   {roundVotes.PrevotesBitArray, roundVotes.Prevotes},
+			"precommit": {roundVotes.PrecommitsBitArray, roundVotes.Precommits},
+		}
+
+		for voteType, vote := range votes {
+			bitArray, err := ParseVoteBitArray(vote.bitArray)
+			if err != nil {
+				sublogger.Error().
+					Int("round", roundVotes.Round).
+					Err(err).
+					Msg("Could not parse the votes of the round")
+				continue
+			}
+
+			labels := prometheus.Labels{"round": strconv.Itoa(roundVotes.Round), "type": voteType}
+			votesGauge.With(labels).Set(float64(bitArray.Voted))
+			if bitArray.TotalPower > 0 {
+				votesPowerRatioGauge.With(labels).Set(float64(bitArray.VotedPower) / float64(bitArray.TotalPower))
+			}
+
+			if roundVotes.Round == round && validatorConsAddress != "" {
+				voted := 0.0
+				if hasVoted(vote.votes, validatorConsAddress) {
+					voted = 1
+				}
+
+				validatorVotedGauge.With(prometheus.Labels{
+					"address":      validatorAddress,
+					"cons_address": validatorConsAddress,
+					"type":         voteType,
+				}).Set(voted)
+			}
+		}
+	}
+
+	return scrape.Wait()
+}
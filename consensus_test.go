@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseVoteBitArray(t *testing.T) {
+	tests := []struct {
+		bitArray string
+		expected *VoteBitArray
+	}{
+		{
+			bitArray: "BA{4:xx_x} 30/40 = 0.75",
+			expected: &VoteBitArray{Validators: 4, Voted: 3, VotedPower: 30, TotalPower: 40},
+		},
+		{
+			bitArray: "BA{3:___} 0/90 = 0.00",
+			expected: &VoteBitArray{Validators: 3, Voted: 0, VotedPower: 0, TotalPower: 90},
+		},
+		{
+			bitArray: "BA{2:xx} 1000000000000/1000000000000 = 1.00",
+			expected: &VoteBitArray{Validators: 2, Voted: 2, VotedPower: 1000000000000, TotalPower: 1000000000000},
+		},
+		{bitArray: ""},
+		{bitArray: "nil-BitArray"},
+		{bitArray: "BA{4:xx_x} 30 = 0.75"},
+		{bitArray: "BA{4:xx_x} 99999999999999999999/40 = 0.75"},
+	}
+
+	for _, test := range tests {
+		bitArray, err := ParseVoteBitArray(test.bitArray)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", test.bitArray, bitArray)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: got error %v", test.bitArray, err)
+			continue
+		}
+
+		if *bitArray != *test.expected {
+			t.Errorf("%q: got %+v, expected %+v", test.bitArray, *bitArray, *test.expected)
+		}
+	}
+}
+
+func TestParseHeightRoundStep(t *testing.T) {
+	tests := []struct {
+		heightRoundStep string
+		height          int64
+		round           int
+		step            int
+		err             bool
+	}{
+		{heightRoundStep: "1234/0/1", height: 1234, round: 0, step: 1},
+		{heightRoundStep: "9876543210/12/8", height: 9876543210, round: 12, step: 8},
+		{heightRoundStep: "", err: true},
+		{heightRoundStep: "1234/0", err: true},
+		{heightRoundStep: "1234/0/1/2", err: true},
+		{heightRoundStep: "a/0/1", err: true},
+		{heightRoundStep: "1234/b/1", err: true},
+		{heightRoundStep: "1234/0/c", err: true},
+	}
+
+	for _, test := range tests {
+		height, round, step, err := ParseHeightRoundStep(test.heightRoundStep)
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, expected error: %t", test.heightRoundStep, err, test.err)
+			continue
+		}
+
+		if height != test.height || round != test.round || step != test.step {
+			t.Errorf(
+				"%q: got %d/%d/%d, expected %d/%d/%d",
+				test.heightRoundStep,
+				height, round, step,
+				test.height, test.round, test.step,
+			)
+		}
+	}
+}
+
+func TestHasVoted(t *testing.T) {
+	votes := []string{
+		"Vote{0:0A1B2C3D4E5F 100/00/SIGNED_MSG_TYPE_PREVOTE(Prevote) 8B01023386C3 4B2C3E09B4E0 @ 2022-01-01T00:00:00.000Z}",
+		"nil-Vote",
+		"Vote{2:ABCDEF012345 100/00/SIGNED_MSG_TYPE_PREVOTE(Prevote) 000000000000 4B2C3E09B4E0 @ 2022-01-01T00:00:00.000Z}",
+	}
+
+	tests := []struct {
+		address  string
+		expected bool
+	}{
+		{address: "0A1B2C3D4E5F00112233445566778899AABBCCDD", expected: true},
+		{address: "0a1b2c3d4e5f00112233445566778899aabbccdd", expected: true},
+		{address: "ABCDEF0123450000000000000000000000000000", expected: true},
+		{address: "1111111111110000000000000000000000000000", expected: false},
+		{address: "0A1B2C", expected: false},
+		{address: "", expected: false},
+	}
+
+	for _, test := range tests {
+		if voted := hasVoted(votes, test.address); voted != test.expected {
+			t.Errorf("%q: got %t, expected %t", test.address, voted, test.expected)
+		}
+	}
+}
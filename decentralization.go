@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sort"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// VotingPowerDistribution is how the voting power is spread over the validators of the active set.
+type VotingPowerDistribution struct {
+	Total sdk.Int
+	// NakamotoHalt is the fewest validators holding at least 1/3 of the voting power, enough to halt the chain.
+	NakamotoHalt int
+	// NakamotoControl is the fewest validators holding more than 2/3 of the voting power, enough to commit blocks on their own.
+	NakamotoControl int
+	// Gini is the Gini coefficient of the voting power, 0 if all the validators have the same.
+	Gini sdk.Dec
+}
+
+func NewVotingPowerDistribution(votingPowers []sdk.Int) *VotingPowerDistribution {
+	sorted := make([]sdk.Int, len(votingPowers))
+	copy(sorted, votingPowers)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GT(sorted[j])
+	})
+
+	distribution := &VotingPowerDistribution{Total: sdk.ZeroInt(), Gini: sdk.ZeroDec()}
+	for _, votingPower := range sorted {
+		distribution.Total = distribution.Total.Add(votingPower)
+	}
+
+	if !distribution.Total.IsPositive() {
+		return distribution
+	}
+
+	cumulative := sdk.ZeroInt()
+	for index, votingPower := range sorted {
+		cumulative = cumulative.Add(votingPower)
+
+		if distribution.NakamotoHalt == 0 && cumulative.MulRaw(3).GTE(distribution.Total) {
+			distribution.NakamotoHalt = index + 1
+		}
+
+		if distribution.NakamotoControl == 0 && cumulative.MulRaw(3).GT(distribution.Total.MulRaw(2)) {
+			distribution.NakamotoControl = index + 1
+			break
+		}
+	}
+
+	// with the voting powers x_1 <= ... <= x_n, G = (2 * sum(i * x_i) - (n + 1) * sum(x_i)) / (n * sum(x_i))
+	n := int64(len(sorted))
+	weighted := sdk.ZeroInt()
+	for index, votingPower := range sorted {
+		weighted = weighted.Add(votingPower.MulRaw(n - int64(index)))
+	}
+
+	distribution.Gini = sdk.NewDecFromInt(weighted.MulRaw(2).Sub(distribution.Total.MulRaw(n + 1))).
+		QuoInt(distribution.Total.MulRaw(n))
+
+	return distribution
+}
+
+// Share is the fraction of the total voting power.
+func (d *VotingPowerDistribution) Share(votingPower sdk.Int) sdk.Dec {
+	if !d.Total.IsPositive() {
+		return sdk.ZeroDec()
+	}
+
+	return sdk.NewDecFromInt(votingPower).QuoInt(d.Total)
+}
+
+// CutoffGaps returns, for every validator ranked by tokens, the tokens it is away from the cutoff of the
+// active set of maxValidators validators. For the validators within the set, it is the tokens they are
+// ahead of the first validator out of it, or all their tokens if the set is not full. For the validators
+// out of the set, it is the tokens they are behind the last validator of the set, a negative number.
+func CutoffGaps(tokens []sdk.Int, maxValidators int) []sdk.Int {
+	gaps := make([]sdk.Int, len(tokens))
+
+	for index, validatorTokens := range tokens {
+		switch {
+		case index >= maxValidators:
+			gaps[index] = validatorTokens.Sub(tokens[maxValidators-1])
+		case len(tokens) > maxValidators:
+			gaps[index] = validatorTokens.Sub(tokens[maxValidators])
+		default:
+			gaps[index] = validatorTokens
+		}
+	}
+
+	return gaps
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+func ints(values ...int64) []sdk.Int {
+	ints := make([]sdk.Int, len(values))
+	for index, value := range values {
+		ints[index] = sdk.NewInt(value)
+	}
+
+	return ints
+}
+
+func TestNewVotingPowerDistribution(t *testing.T) {
+	tests := []struct {
+		name            string
+		votingPowers    []sdk.Int
+		total           int64
+		nakamotoHalt    int
+		nakamotoControl int
+		gini            string
+	}{
+		{name: "no validators", total: 0, gini: "0"},
+		{name: "no voting power", votingPowers: ints(0, 0), total: 0, gini: "0"},
+		{name: "equal", votingPowers: ints(10, 10, 10, 10), total: 40, nakamotoHalt: 2, nakamotoControl: 3, gini: "0"},
+		// 1/3 is enough to halt, 2/3 is not enough to control
+		{name: "exactly 1/3 and 2/3", votingPowers: ints(1, 1, 1), total: 3, nakamotoHalt: 1, nakamotoControl: 3, gini: "0"},
+		{name: "exactly 2/3", votingPowers: ints(2, 1), total: 3, nakamotoHalt: 1, nakamotoControl: 2, gini: "0.166666666666666666"},
+		{name: "above 1/3", votingPowers: ints(33, 34, 33), total: 100, nakamotoHalt: 1, nakamotoControl: 2, gini: "0.006666666666666666"},
+		{name: "below 1/3", votingPowers: ints(33, 33, 33, 1), total: 100, nakamotoHalt: 2, nakamotoControl: 3, gini: "0.24"},
+		{name: "single validator", votingPowers: ints(100), total: 100, nakamotoHalt: 1, nakamotoControl: 1, gini: "0"},
+		{name: "concentrated", votingPowers: ints(100, 0, 0, 0), total: 100, nakamotoHalt: 1, nakamotoControl: 1, gini: "0.75"},
+		{name: "unequal", votingPowers: ints(20, 50, 30), total: 100, nakamotoHalt: 1, nakamotoControl: 2, gini: "0.2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distribution := NewVotingPowerDistribution(test.votingPowers)
+
+			if !distribution.Total.Equal(sdk.NewInt(test.total)) {
+				t.Errorf("got total %s, expected %d", distribution.Total, test.total)
+			}
+
+			if distribution.NakamotoHalt != test.nakamotoHalt || distribution.NakamotoControl != test.nakamotoControl {
+				t.Errorf(
+					"got Nakamoto coefficients %d to halt and %d to control, expected %d and %d",
+					distribution.NakamotoHalt, distribution.NakamotoControl,
+					test.nakamotoHalt, test.nakamotoControl,
+				)
+			}
+
+			if !distribution.Gini.Equal(sdk.MustNewDecFromStr(test.gini)) {
+				t.Errorf("got Gini coefficient %s, expected %s", distribution.Gini, test.gini)
+			}
+		})
+	}
+}
+
+func TestVotingPowerDistributionShare(t *testing.T) {
+	distribution := NewVotingPowerDistribution(ints(50, 30, 20))
+	if share := distribution.Share(sdk.NewInt(30)); !share.Equal(sdk.MustNewDecFromStr("0.3")) {
+		t.Errorf("got share %s, expected 0.3", share)
+	}
+
+	distribution = NewVotingPowerDistribution(nil)
+	if share := distribution.Share(sdk.NewInt(30)); !share.IsZero() {
+		t.Errorf("got share %s without voting power, expected 0", share)
+	}
+}
+
+func TestCutoffGaps(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokens        []sdk.Int
+		maxValidators int
+		expected      []sdk.Int
+	}{
+		{name: "no validators", maxValidators: 2, expected: ints()},
+		{name: "set full", tokens: ints(50, 40, 30, 20), maxValidators: 2, expected: ints(20, 10, -10, -20)},
+		{name: "set exactly full", tokens: ints(50, 40), maxValidators: 2, expected: ints(50, 40)},
+		{name: "set not full", tokens: ints(50, 40), maxValidators: 3, expected: ints(50, 40)},
+		{name: "tie at the cutoff", tokens: ints(50, 30, 30), maxValidators: 2, expected: ints(20, 0, 0)},
+		{name: "single validator in the set", tokens: ints(50, 40, 10), maxValidators: 1, expected: ints(10, -10, -40)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gaps := CutoffGaps(test.tokens, test.maxValidators)
+			if len(gaps) != len(test.expected) {
+				t.Fatalf("got %d gaps, expected %d", len(gaps), len(test.expected))
+			}
+
+			for index, gap := range gaps {
+				if !gap.Equal(test.expected[index]) {
+					t.Errorf("validator %d: got gap %s, expected %s", index+1, gap, test.expected[index])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// ExporterMetrics are the metrics about the exporter itself, served on /metrics.
+type ExporterMetrics struct {
+	Registry *prometheus.Registry
+
+	collectorDuration *prometheus.HistogramVec
+	collectorUp       *prometheus.GaugeVec
+	collectorErrors   *prometheus.CounterVec
+	queryTimeouts     *prometheus.CounterVec
+	collectorUpstream *prometheus.GaugeVec
+	queryPages        *prometheus.GaugeVec
+
+	upstreamUp     *prometheus.GaugeVec
+	upstreamHeight *prometheus.GaugeVec
+
+	grpcDuration *prometheus.HistogramVec
+	grpcErrors   *prometheus.CounterVec
+	grpcInFlight prometheus.Gauge
+
+	httpRequests *prometheus.CounterVec
+	httpInFlight *prometheus.GaugeVec
+
+	mutex         sync.Mutex
+	lastUpstreams map[[2]string]string
+}
+
+func NewExporterMetrics() *ExporterMetrics {
+	m := &ExporterMetrics{
+		Registry:      prometheus.NewRegistry(),
+		lastUpstreams: map[[2]string]string{},
+
+		collectorDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "cosmos_exporter_collector_duration_seconds",
+				Help:    "Time it took to collect the metrics of a collector, in seconds",
+				Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+			},
+			[]string{"chain", "collector"},
+		),
+		collectorUp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_collector_up",
+				Help: "1 if all the queries of the latest collection succeeded, 0 if no",
+			},
+			[]string{"chain", "collector"},
+		),
+		collectorErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cosmos_exporter_collector_errors_total",
+				Help: "Number of collections during which at least one query failed",
+			},
+			[]string{"chain", "collector"},
+		),
+		queryTimeouts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cosmos_exporter_query_timeouts_total",
+				Help: "Number of queries that timed out, leaving the metrics of the collector partially filled",
+			},
+			[]string{"chain", "collector"},
+		),
+		collectorUpstream: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_collector_upstream",
+				Help: "Node the latest collection of a collector was queried on, always 1",
+			},
+			[]string{"chain", "collector", "upstream"},
+		),
+
+		queryPages: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_query_pages",
+				Help: "Number of pages the paginated queries of the latest collection of a collector took",
+			},
+			[]string{"chain", "collector", "query"},
+		),
+
+		upstreamUp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_upstream_up",
+				Help: "1 if the node is reachable, synced and not lagging behind the others, 0 if no",
+			},
+			[]string{"chain", "upstream"},
+		),
+		upstreamHeight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_upstream_latest_block_height",
+				Help: "Latest block height of the node at the last health check",
+			},
+			[]string{"chain", "upstream"},
+		),
+
+		grpcDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "cosmos_exporter_grpc_request_duration_seconds",
+				Help:    "Time it took the node to respond to a gRPC query, in seconds",
+				Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			[]string{"chain", "module", "method"},
+		),
+		grpcErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cosmos_exporter_grpc_errors_total",
+				Help: "Number of failed gRPC queries",
+			},
+			[]string{"chain", "module", "method", "code"},
+		),
+		grpcInFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_grpc_requests_in_flight",
+				Help: "Number of gRPC queries currently waiting for the node to respond",
+			},
+		),
+
+		httpRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cosmos_exporter_http_requests_total",
+				Help: "Number of scrapes of the collectors endpoints",
+			},
+			[]string{"collector", "code"},
+		),
+		httpInFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cosmos_exporter_http_requests_in_flight",
+				Help: "Number of scrapes of the collectors endpoints currently being served",
+			},
+			[]string{"collector"},
+		),
+	}
+
+	m.Registry.MustRegister(m.collectorDuration)
+	m.Registry.MustRegister(m.collectorUp)
+	m.Registry.MustRegister(m.collectorErrors)
+	m.Registry.MustRegister(m.queryTimeouts)
+	m.Registry.MustRegister(m.collectorUpstream)
+	m.Registry.MustRegister(m.queryPages)
+	m.Registry.MustRegister(m.upstreamUp)
+	m.Registry.MustRegister(m.upstreamHeight)
+	m.Registry.MustRegister(m.grpcDuration)
+	m.Registry.MustRegister(m.grpcErrors)
+	m.Registry.MustRegister(m.grpcInFlight)
+	m.Registry.MustRegister(m.httpRequests)
+	m.Registry.MustRegister(m.httpInFlight)
+	m.Registry.MustRegister(prometheus.NewGoCollector())
+	m.Registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	return m
+}
+
+// Handler serves the exporter metrics.
+func (m *ExporterMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentHandler counts the scrapes of a collector endpoint and the ones in flight.
+func (m *ExporterMetrics) InstrumentHandler(collector string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"collector": collector}
+
+	return promhttp.InstrumentHandlerInFlight(
+		m.httpInFlight.With(labels),
+		promhttp.InstrumentHandlerCounter(m.httpRequests.MustCurryWith(labels), handler),
+	)
+}
+
+// ObserveCollection records the duration and the result of a collection.
+func (m *ExporterMetrics) ObserveCollection(chain, collector string, duration time.Duration, err error, timeouts int) {
+	m.collectorDuration.WithLabelValues(chain, collector).Observe(duration.Seconds())
+	m.queryTimeouts.WithLabelValues(chain, collector).Add(float64(timeouts))
+
+	if err != nil {
+		m.collectorUp.WithLabelValues(chain, collector).Set(0)
+		m.collectorErrors.WithLabelValues(chain, collector).Inc()
+		return
+	}
+
+	m.collectorUp.WithLabelValues(chain, collector).Set(1)
+}
+
+// ObserveCollectorUpstream records the node the latest collection was queried on.
+func (m *ExporterMetrics) ObserveCollectorUpstream(chain, collector, upstream string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := [2]string{chain, collector}
+	if last, ok := m.lastUpstreams[key]; ok && last != upstream {
+		m.collectorUpstream.DeleteLabelValues(chain, collector, last)
+	}
+
+	m.lastUpstreams[key] = upstream
+	m.collectorUpstream.WithLabelValues(chain, collector, upstream).Set(1)
+}
+
+// ObserveQueryPages records the number of pages the paginated queries of a collection took.
+func (m *ExporterMetrics) ObserveQueryPages(chain, collector string, pages map[string]int) {
+	for query, count := range pages {
+		m.queryPages.WithLabelValues(chain, collector, query).Set(float64(count))
+	}
+}
+
+// ObserveUpstream records the result of the health check of a node.
+func (m *ExporterMetrics) ObserveUpstream(chain, upstream string, healthy bool, height int64) {
+	up := 0.0
+	if healthy {
+		up = 1
+	}
+
+	m.upstreamUp.WithLabelValues(chain, upstream).Set(up)
+	m.upstreamHeight.WithLabelValues(chain, upstream).Set(float64(height))
+}
+
+// UnaryClientInterceptor times every gRPC query to the node of the chain
+// and counts the failed ones by status code.
+func (m *ExporterMetrics) UnaryClientInterceptor(chain string) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		module, name := splitGrpcMethod(method)
+
+		m.grpcInFlight.Inc()
+		defer m.grpcInFlight.Dec()
+
+		queryStart := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		m.grpcDuration.WithLabelValues(chain, module, name).Observe(time.Since(queryStart).Seconds())
+
+		if err != nil {
+			m.grpcErrors.WithLabelValues(chain, module, name, status.Code(err).String()).Inc()
+		}
+
+		return err
+	}
+}
+
+// splitGrpcMethod turns "/cosmos.staking.v1beta1.Query/Validators" into "staking" and "Validators".
+func splitGrpcMethod(fullMethod string) (string, string) {
+	service, method := "", fullMethod
+
+	if index := strings.LastIndex(fullMethod, "/"); index >= 0 {
+		service, method = strings.TrimPrefix(fullMethod[:index], "/"), fullMethod[index+1:]
+	}
+
+	parts := strings.Split(service, ".")
+	if len(parts) < 3 {
+		return service, method
+	}
+
+	return parts[len(parts)-3], method
+}
@@ -3,150 +3,135 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
 	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	distributiontypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	minttypes "github.com/cosmos/cosmos-sdk/x/mint/types"
 	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"google.golang.org/grpc"
 )
 
-func GeneralHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
-	requestStart := time.Now()
+type GeneralCollector struct {
+	httpClient *http.Client
+}
+
+func NewGeneralCollector() *GeneralCollector {
+	return &GeneralCollector{
+		httpClient: &http.Client{Timeout: RestTimeout},
+	}
+}
 
-	sublogger := log.With().
-		Str("request-id", uuid.New().String()).
-		Logger()
+func (c *GeneralCollector) Name() string {
+	return "general"
+}
+
+func (c *GeneralCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *GeneralCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	grpcConn := scrape.Upstream.GrpcConn
+	sublogger := scrape.Logger
+
+	generalBondedTokensGauge := scrape.NewGaugeVec(
+		"cosmos_general_bonded_tokens",
+		"Bonded tokens",
+		"denom",
+	)
+
+	generalNotBondedTokensGauge := scrape.NewGaugeVec(
+		"cosmos_general_not_bonded_tokens",
+		"Not bonded tokens",
+		"denom",
+	)
 
-	generalBondedTokensGauge := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_general_bonded_tokens",
-			Help:        "Bonded tokens",
-			ConstLabels: ConstLabels,
-		},
+	generalCommunityPoolGauge := scrape.NewGaugeVec(
+		"cosmos_general_community_pool",
+		"Community pool",
+		"denom", "display",
 	)
 
-	generalNotBondedTokensGauge := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_general_not_bonded_tokens",
-			Help:        "Not bonded tokens",
-			ConstLabels: ConstLabels,
-		},
+	generalSupplyTotalGauge := scrape.NewGaugeVec(
+		"cosmos_general_supply_total",
+		"Total supply",
+		"denom", "display", "base_denom", "path", "source_channel",
 	)
 
-	generalCommunityPoolGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_general_community_pool",
-			Help:        "Community pool",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"denom"},
+	generalTokenPriceGauge := scrape.NewGaugeVec(
+		"cosmos_token_price",
+		"Token Price",
+		"token", "currency",
 	)
 
-	generalSupplyTotalGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_general_supply_total",
-			Help:        "Total supply",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"denom"},
+	generalInflationGauge := scrape.NewGauge(
+		"cosmos_general_inflation",
+		"Inflation",
 	)
 
-	generalTokenPriceGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_token_price",
-			Help:        "Token Price",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"token", "currency"},
+	generalAnnualProvisions := scrape.NewGaugeVec(
+		"cosmos_general_annual_provisions",
+		"Annual provisions",
+		"denom",
 	)
 
-	// generalInflationGauge := prometheus.NewGauge(
-	// 	prometheus.GaugeOpts{
-	// 		Name:        "cosmos_general_inflation",
-	// 		Help:        "Total supply",
-	// 		ConstLabels: ConstLabels,
-	// 	},
-	// )
-
-	// generalAnnualProvisions := prometheus.NewGaugeVec(
-	// 	prometheus.GaugeOpts{
-	// 		Name:        "cosmos_general_annual_provisions",
-	// 		Help:        "Annual provisions",
-	// 		ConstLabels: ConstLabels,
-	// 	},
-	// 	[]string{"denom"},
-	// )
-
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(generalBondedTokensGauge)
-	registry.MustRegister(generalNotBondedTokensGauge)
-	registry.MustRegister(generalCommunityPoolGauge)
-	registry.MustRegister(generalSupplyTotalGauge)
-	registry.MustRegister(generalTokenPriceGauge)
-	// registry.MustRegister(generalInflationGauge)
-	// registry.MustRegister(generalAnnualProvisions)
-
-	var wg sync.WaitGroup
-
-	go func() {
-		defer wg.Done()
+	generalBondedRatioGauge := scrape.NewGauge(
+		"cosmos_general_bonded_ratio",
+		"Bonded tokens as a fraction of the total supply of the minted denom",
+	)
+
+	generalNominalAPRGauge := scrape.NewGauge(
+		"cosmos_general_nominal_apr",
+		"Staking APR before inflation, from the inflation, community tax and bonded ratio",
+	)
+
+	generalRealAPRGauge := scrape.NewGauge(
+		"cosmos_general_real_apr",
+		"Staking APR after inflation",
+	)
+
+	scrape.Go(func() error {
 		sublogger.Debug().Msg("Started querying staking pool")
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
 		response, err := stakingClient.Pool(
-			context.Background(),
+			ctx,
 			&stakingtypes.QueryPoolRequest{},
 		)
 		if err != nil {
 			sublogger.Error().Err(err).Msg("Could not get staking pool")
-			return
+			return err
 		}
 
 		sublogger.Debug().
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying staking pool")
 
-		if value, err := strconv.ParseFloat(response.Pool.BondedTokens.String(), 64); err != nil {
-			sublogger.Error().
-				Err(err).
-				Msg("Could not parse staking pool bonded tokens")
-		} else {
-			generalBondedTokensGauge.Set(value)
-		}
-
-		if value, err := strconv.ParseFloat(response.Pool.NotBondedTokens.String(), 64); err != nil {
-			sublogger.Error().
-				Err(err).
-				Msg("Could not parse staking pool unbonded tokens")
-		} else {
-			generalNotBondedTokensGauge.Set(value)
-		}
-
-	}()
-	wg.Add(1)
+		denoms := scrape.Chain.Denoms
+		generalBondedTokensGauge.With(prometheus.Labels{"denom": denoms.Denom}).
+			Set(denoms.BondIntAmount(response.Pool.BondedTokens))
+		generalNotBondedTokensGauge.With(prometheus.Labels{"denom": denoms.Denom}).
+			Set(denoms.BondIntAmount(response.Pool.NotBondedTokens))
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().Msg("Started querying distribution community pool")
 		queryStart := time.Now()
 
 		distributionClient := distributiontypes.NewQueryClient(grpcConn)
 		response, err := distributionClient.CommunityPool(
-			context.Background(),
+			ctx,
 			&distributiontypes.QueryCommunityPoolRequest{},
 		)
 		if err != nil {
 			sublogger.Error().Err(err).Msg("Could not get distribution community pool")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -154,67 +139,73 @@ func GeneralHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Clien
 			Msg("Finished querying distribution community pool")
 
 		for _, coin := range response.Pool {
-			if value, err := strconv.ParseFloat(coin.Amount.String(), 64); err != nil {
-				sublogger.Error().
-					Err(err).
-					Msg("Could not get community pool coin")
-			} else {
-				generalCommunityPoolGauge.With(prometheus.Labels{
-					"denom": Denom,
-				}).Set(value / DenomCoefficient)
-			}
+			value, denom, display := scrape.Chain.Denoms.Amount(coin.Denom, coin.Amount)
+			generalCommunityPoolGauge.With(prometheus.Labels{
+				"denom":   denom,
+				"display": strconv.FormatBool(display),
+			}).Set(value)
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().Msg("Started querying bank total supply")
 		queryStart := time.Now()
 
+		var supply []sdk.Coin
+
 		bankClient := banktypes.NewQueryClient(grpcConn)
-		response, err := bankClient.TotalSupply(
-			context.Background(),
-			&banktypes.QueryTotalSupplyRequest{},
-		)
+		err := scrape.Paginate("bank/TotalSupply", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			response, err := bankClient.TotalSupply(
+				ctx,
+				&banktypes.QueryTotalSupplyRequest{Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			supply = append(supply, response.Supply...)
+			return response.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().Err(err).Msg("Could not get bank total supply")
-			return
+			return err
 		}
 
 		sublogger.Debug().
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying bank total supply")
 
-		for _, coin := range response.Supply {
-			if value, err := strconv.ParseFloat(coin.Amount.String(), 64); err != nil {
-				sublogger.Error().
-					Str("Denom", coin.Denom).
-					Err(err).
-					Msg("Could not get total supply for coin")
-			} else {
-
-				generalSupplyTotalGauge.With(prometheus.Labels{
-					"denom": coin.Denom,
-				}).Set(value)
-			}
+		denoms := make([]string, len(supply))
+		for index, coin := range supply {
+			denoms[index] = coin.Denom
+		}
+
+		// the IBC denoms whose trace could not be fetched are labelled as they are
+		if err := scrape.Chain.DenomTraces.Resolve(ctx, scrape, grpcConn, denoms); err != nil {
+			sublogger.Warn().Err(err).Msg("Could not resolve all the IBC denom traces")
+		}
+
+		for _, coin := range supply {
+			value, denom, display := scrape.Chain.Denoms.CoinAmount(coin)
+			labels := scrape.Chain.DenomTraces.Get(coin.Denom).Labels()
+			labels["denom"] = denom
+			labels["display"] = strconv.FormatBool(display)
+			generalSupplyTotalGauge.With(labels).Set(value)
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().Msg("Started querying token prices")
 		queryStart := time.Now()
 
 		for _, token := range TokenPrices {
-			println(token)
-			response, err := http.Get("https://api.coingecko.com/api/v3/coins/" + token)
-
+			responseBytes, err := HTTPGet(ctx, c.httpClient, "https://api.coingecko.com/api/v3/coins/"+token)
 			if err != nil {
 				sublogger.Error().Err(err).Str("Token", token).Msg("Could not get token price")
-				return
+				return err
 			}
 
 			var coinGeckoResponse struct {
@@ -225,16 +216,10 @@ func GeneralHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Clien
 					} `json:"current_price"`
 				} `json:"market_data"`
 			}
-			responseBytes, err := io.ReadAll(response.Body)
-
-			if err != nil {
-				sublogger.Error().Err(err).Str("Token", token).Msg("Could not read response body")
-				return
-			}
 			err = json.Unmarshal(responseBytes, &coinGeckoResponse)
 			if err != nil {
 				sublogger.Error().Err(err).Str("Token", token).Msg("Could not umarshal json")
-				return
+				return err
 			}
 
 			generalTokenPriceGauge.With(prometheus.Labels{
@@ -250,75 +235,76 @@ func GeneralHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Clien
 		sublogger.Debug().
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying token prices")
-	}()
-	wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	sublogger.Debug().Msg("Started querying inflation")
-	// 	queryStart := time.Now()
-
-	// 	mintClient := minttypes.NewQueryClient(grpcConn)
-	// 	response, err := mintClient.Inflation(
-	// 		context.Background(),
-	// 		&minttypes.QueryInflationRequest{},
-	// 	)
-	// 	if err != nil {
-	// 		sublogger.Error().Err(err).Msg("Could not get inflation")
-	// 		return
-	// 	}
-
-	// 	sublogger.Debug().
-	// 		Float64("request-time", time.Since(queryStart).Seconds()).
-	// 		Msg("Finished querying inflation")
-
-	// 	if value, err := strconv.ParseFloat(response.Inflation.String(), 64); err != nil {
-	// 		sublogger.Error().
-	// 			Err(err).
-	// 			Msg("Could not get inflation")
-	// 	} else {
-	// 		generalInflationGauge.Set(value)
-	// 	}
-	// }()
-	// wg.Add(1)
-
-	// go func() {
-	// 	defer wg.Done()
-	// 	sublogger.Debug().Msg("Started querying annual provisions")
-	// 	queryStart := time.Now()
-
-	// 	mintClient := minttypes.NewQueryClient(grpcConn)
-	// 	response, err := mintClient.AnnualProvisions(
-	// 		context.Background(),
-	// 		&minttypes.QueryAnnualProvisionsRequest{},
-	// 	)
-	// 	if err != nil {
-	// 		sublogger.Error().Err(err).Msg("Could not get annual provisions")
-	// 		return
-	// 	}
-
-	// 	sublogger.Debug().
-	// 		Float64("request-time", time.Since(queryStart).Seconds()).
-	// 		Msg("Finished querying annual provisions")
-
-	// 	if value, err := strconv.ParseFloat(response.AnnualProvisions.String(), 64); err != nil {
-	// 		sublogger.Error().
-	// 			Err(err).
-	// 			Msg("Could not get annual provisions")
-	// 	} else {
-	// 		generalAnnualProvisions.With(prometheus.Labels{
-	// 			"denom": Denom,
-	// 		}).Set(value / DenomCoefficient)
-	// 	}
-	// }()
-	// wg.Add(1)
-
-	wg.Wait()
-
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/general").
-		Float64("request-time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+		return nil
+	})
+
+	var aprInputs *StakingAPRInputs
+	var annualProvisions sdk.Dec
+
+	scrape.Go(func() error {
+		var err error
+		aprInputs, err = FetchStakingAPRInputs(ctx, scrape, grpcConn, scrape.Chain.Capabilities)
+		return err
+	})
+
+	// some chains have their own mint module instead of x/mint, there's no inflation to expose then
+	if scrape.Chain.Capabilities.IsSupported(mintQuery) {
+		scrape.Go(func() error {
+			sublogger.Debug().Msg("Started querying annual provisions")
+			queryStart := time.Now()
+
+			mintClient := minttypes.NewQueryClient(grpcConn)
+			response, err := mintClient.AnnualProvisions(
+				ctx,
+				&minttypes.QueryAnnualProvisionsRequest{},
+			)
+			if !scrape.Chain.Capabilities.Check(mintQuery, err) {
+				return nil
+			}
+
+			if err != nil {
+				sublogger.Error().Err(err).Msg("Could not get annual provisions")
+				return err
+			}
+
+			sublogger.Debug().
+				Float64("request-time", time.Since(queryStart).Seconds()).
+				Msg("Finished querying annual provisions")
+
+			annualProvisions = response.AnnualProvisions
+			return nil
+		})
+	}
+
+	// the errors are returned by the scrape.Wait() below as well
+	_ = scrape.Wait()
+
+	if aprInputs == nil {
+		return scrape.Wait()
+	}
+
+	generalInflationGauge.Set(DecToFloat64(aprInputs.Inflation))
+
+	// the provisions are minted in the mint denom, which is not always the bond denom
+	if !annualProvisions.IsNil() {
+		value, denom, _ := scrape.Chain.Denoms.Amount(aprInputs.MintDenom, annualProvisions)
+		generalAnnualProvisions.With(prometheus.Labels{
+			"denom": denom,
+		}).Set(value)
+	}
+
+	apr, err := aprInputs.APR()
+	if err != nil {
+		sublogger.Warn().
+			Str("denom", aprInputs.MintDenom).
+			Err(err).
+			Msg("Could not compute the staking APR")
+		return scrape.Wait()
+	}
+
+	generalBondedRatioGauge.Set(DecToFloat64(apr.BondedRatio))
+	generalNominalAPRGauge.Set(DecToFloat64(apr.Nominal))
+	generalRealAPRGauge.Set(DecToFloat64(apr.Real))
+
+	return scrape.Wait()
 }
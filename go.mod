@@ -1,4 +1,4 @@
-module main
+module github.com/wajones98/cosmos-exporter
 
 go 1.16
 
@@ -8,6 +8,7 @@ replace google.golang.org/grpc => google.golang.org/grpc v1.33.2
 
 require (
 	github.com/cosmos/cosmos-sdk v0.45.1
+	github.com/cosmos/ibc-go/v2 v2.0.3
 	github.com/enigmampc/btcutil v1.0.3-0.20200723161021-e2fb6adb2a25 // indirect
 	github.com/ethereum/go-ethereum v1.10.16
 	github.com/google/uuid v1.2.0
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/simapp"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type GovCollector struct{}
+
+func NewGovCollector() *GovCollector {
+	return &GovCollector{}
+}
+
+func (c *GovCollector) Name() string {
+	return "gov"
+}
+
+func (c *GovCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *GovCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	grpcConn := scrape.Upstream.GrpcConn
+	sublogger := scrape.Logger
+	denoms := scrape.Chain.Denoms
+
+	govProposalsGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposals",
+		"Number of proposals in deposit or voting period",
+		"status",
+	)
+
+	govProposalStatusGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposal_status",
+		"Status of the proposal in deposit or voting period, always 1",
+		"proposal_id", "title", "type", "status",
+	)
+
+	govProposalDepositEndTimeGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposal_deposit_end_time",
+		"End of the deposit period of the proposal, as a unix timestamp",
+		"proposal_id",
+	)
+
+	govProposalVotingStartTimeGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposal_voting_start_time",
+		"Start of the voting period of the proposal, as a unix timestamp",
+		"proposal_id",
+	)
+
+	govProposalVotingEndTimeGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposal_voting_end_time",
+		"End of the voting period of the proposal, as a unix timestamp",
+		"proposal_id",
+	)
+
+	govProposalDepositGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposal_total_deposit",
+		"Total deposit of the proposal",
+		"proposal_id", "denom", "display",
+	)
+
+	govProposalTallyGauge := scrape.NewGaugeVec(
+		"cosmos_gov_proposal_tally",
+		"Current tally of the proposal in voting period, as a fraction of the bonded tokens",
+		"proposal_id", "option",
+	)
+
+	govParamsQuorumGauge := scrape.NewGauge(
+		"cosmos_gov_params_quorum",
+		"Minimum fraction of the bonded tokens voting for the result to be valid",
+	)
+
+	govParamsThresholdGauge := scrape.NewGauge(
+		"cosmos_gov_params_threshold",
+		"Minimum fraction of yes votes for the proposal to pass",
+	)
+
+	govParamsVetoThresholdGauge := scrape.NewGauge(
+		"cosmos_gov_params_veto_threshold",
+		"Minimum fraction of no with veto votes for the proposal to be vetoed",
+	)
+
+	govParamsVotingPeriodGauge := scrape.NewGauge(
+		"cosmos_gov_params_voting_period",
+		"Voting period, in seconds",
+	)
+
+	govParamsMaxDepositPeriodGauge := scrape.NewGauge(
+		"cosmos_gov_params_max_deposit_period",
+		"Maximum deposit period, in seconds",
+	)
+
+	govParamsMinDepositGauge := scrape.NewGaugeVec(
+		"cosmos_gov_params_min_deposit",
+		"Minimum deposit for a proposal to enter voting period",
+		"denom", "display",
+	)
+
+	scrape.Go(func() error {
+		sublogger.Debug().Msg("Started querying gov params")
+		queryStart := time.Now()
+
+		govClient := govtypes.NewQueryClient(grpcConn)
+
+		tallyingResponse, err := govClient.Params(ctx, &govtypes.QueryParamsRequest{ParamsType: govtypes.ParamTallying})
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not get gov tallying params")
+			return err
+		}
+
+		votingResponse, err := govClient.Params(ctx, &govtypes.QueryParamsRequest{ParamsType: govtypes.ParamVoting})
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not get gov voting params")
+			return err
+		}
+
+		depositResponse, err := govClient.Params(ctx, &govtypes.QueryParamsRequest{ParamsType: govtypes.ParamDeposit})
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not get gov deposit params")
+			return err
+		}
+
+		sublogger.Debug().
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying gov params")
+
+		govParamsQuorumGauge.Set(DecToFloat64(tallyingResponse.TallyParams.Quorum))
+		govParamsThresholdGauge.Set(DecToFloat64(tallyingResponse.TallyParams.Threshold))
+		govParamsVetoThresholdGauge.Set(DecToFloat64(tallyingResponse.TallyParams.VetoThreshold))
+		govParamsVotingPeriodGauge.Set(votingResponse.VotingParams.VotingPeriod.Seconds())
+		govParamsMaxDepositPeriodGauge.Set(depositResponse.DepositParams.MaxDepositPeriod.Seconds())
+
+		for _, coin := range depositResponse.DepositParams.MinDeposit {
+			value, denom, display := denoms.CoinAmount(coin)
+			govParamsMinDepositGauge.With(prometheus.Labels{
+				"denom":   denom,
+				"display": strconv.FormatBool(display),
+			}).Set(value)
+		}
+		return nil
+	})
+
+	var bondedTokens sdk.Int
+	var proposals []govtypes.Proposal
+
+	scrape.Go(func() error {
+		sublogger.Debug().Msg("Started querying staking pool")
+		queryStart := time.Now()
+
+		stakingClient := stakingtypes.NewQueryClient(grpcConn)
+		response, err := stakingClient.Pool(
+			ctx,
+			&stakingtypes.QueryPoolRequest{},
+		)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not get staking pool")
+			return err
+		}
+
+		sublogger.Debug().
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying staking pool")
+
+		bondedTokens = response.Pool.BondedTokens
+		return nil
+	})
+
+	scrape.Go(func() error {
+		sublogger.Debug().Msg("Started querying proposals")
+		queryStart := time.Now()
+
+		govClient := govtypes.NewQueryClient(grpcConn)
+
+		// the proposals that ended are not queried, there can be a lot of them
+		for _, proposalStatus := range []govtypes.ProposalStatus{govtypes.StatusDepositPeriod, govtypes.StatusVotingPeriod} {
+			err := scrape.Paginate(
+				fmt.Sprintf("gov/Proposals?status=%s", proposalStatus),
+				func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+					response, err := govClient.Proposals(
+						ctx,
+						&govtypes.QueryProposalsRequest{ProposalStatus: proposalStatus, Pagination: pageRequest},
+					)
+					if err != nil {
+						return nil, err
+					}
+
+					proposals = append(proposals, response.Proposals...)
+					return response.Pagination, nil
+				},
+			)
+			if err != nil {
+				sublogger.Error().
+					Str("status", proposalStatus.String()).
+					Err(err).
+					Msg("Could not get proposals")
+				return err
+			}
+		}
+
+		sublogger.Debug().
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying proposals")
+		return nil
+	})
+
+	// the tallies need both the proposals and the bonded tokens, the errors are returned by the scrape.Wait() below
+	_ = scrape.Wait()
+
+	interfaceRegistry := simapp.MakeTestEncodingConfig().InterfaceRegistry
+
+	proposalsCount := map[govtypes.ProposalStatus]int{
+		govtypes.StatusDepositPeriod: 0,
+		govtypes.StatusVotingPeriod:  0,
+	}
+
+	for _, proposal := range proposals {
+		proposalID := strconv.FormatUint(proposal.ProposalId, 10)
+		proposalsCount[proposal.Status]++
+
+		// Unpack interfaces, to populate the Anys' cached values. The proposal types specific to the chain are unknown.
+		if err := proposal.UnpackInterfaces(interfaceRegistry); err != nil {
+			sublogger.Debug().
+				Str("proposal_id", proposalID).
+				Err(err).
+				Msg("Could not unpack proposal content")
+		}
+
+		govProposalStatusGauge.With(prometheus.Labels{
+			"proposal_id": proposalID,
+			"title":       proposal.GetTitle(),
+			"type":        proposal.ProposalType(),
+			"status":      proposal.Status.String(),
+		}).Set(1)
+
+		govProposalDepositEndTimeGauge.With(prometheus.Labels{
+			"proposal_id": proposalID,
+		}).Set(float64(proposal.DepositEndTime.Unix()))
+
+		for _, coin := range proposal.TotalDeposit {
+			value, denom, display := denoms.CoinAmount(coin)
+			govProposalDepositGauge.With(prometheus.Labels{
+				"proposal_id": proposalID,
+				"denom":       denom,
+				"display":     strconv.FormatBool(display),
+			}).Set(value)
+		}
+
+		if proposal.Status != govtypes.StatusVotingPeriod {
+			continue
+		}
+
+		govProposalVotingStartTimeGauge.With(prometheus.Labels{
+			"proposal_id": proposalID,
+		}).Set(float64(proposal.VotingStartTime.Unix()))
+
+		govProposalVotingEndTimeGauge.With(prometheus.Labels{
+			"proposal_id": proposalID,
+		}).Set(float64(proposal.VotingEndTime.Unix()))
+
+		if bondedTokens.IsNil() || !bondedTokens.IsPositive() {
+			continue
+		}
+
+		proposalID, proposalIDNumber := proposalID, proposal.ProposalId
+		scrape.Go(func() error {
+			sublogger.Debug().
+				Str("proposal_id", proposalID).
+				Msg("Started querying proposal tally")
+			queryStart := time.Now()
+
+			govClient := govtypes.NewQueryClient(grpcConn)
+			response, err := govClient.TallyResult(
+				ctx,
+				&govtypes.QueryTallyResultRequest{ProposalId: proposalIDNumber},
+			)
+			if err != nil {
+				sublogger.Error().
+					Str("proposal_id", proposalID).
+					Err(err).
+					Msg("Could not get proposal tally")
+				return err
+			}
+
+			sublogger.Debug().
+				Str("proposal_id", proposalID).
+				Float64("request-time", time.Since(queryStart).Seconds()).
+				Msg("Finished querying proposal tally")
+
+			bonded := sdk.NewDecFromInt(bondedTokens)
+			options := map[string]sdk.Int{
+				VoteOptionLabel(govtypes.OptionYes):        response.Tally.Yes,
+				VoteOptionLabel(govtypes.OptionNo):         response.Tally.No,
+				VoteOptionLabel(govtypes.OptionAbstain):    response.Tally.Abstain,
+				VoteOptionLabel(govtypes.OptionNoWithVeto): response.Tally.NoWithVeto,
+			}
+
+			for option, votes := range options {
+				if votes.IsNil() {
+					votes = sdk.ZeroInt()
+				}
+
+				govProposalTallyGauge.With(prometheus.Labels{
+					"proposal_id": proposalID,
+					"option":      option,
+				}).Set(DecToFloat64(sdk.NewDecFromInt(votes).Quo(bonded)))
+			}
+			return nil
+		})
+	}
+
+	for proposalStatus, count := range proposalsCount {
+		govProposalsGauge.With(prometheus.Labels{
+			"status": proposalStatus.String(),
+		}).Set(float64(count))
+	}
+
+	return scrape.Wait()
+}
+
+// VoteOptionLabel returns the option label of the gov metrics, e.g. "no_with_veto" for VOTE_OPTION_NO_WITH_VETO.
+func VoteOptionLabel(option govtypes.VoteOption) string {
+	return strings.ToLower(strings.TrimPrefix(option.String(), "VOTE_OPTION_"))
+}
+
+// IsVoteNotFound returns true if the Vote query failed because the voter has not voted on the proposal.
+func IsVoteNotFound(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return true
+	case codes.InvalidArgument:
+		// the SDK returns an invalid argument error if the voter has not voted yet
+		return strings.Contains(status.Convert(err).Message(), "not found")
+	default:
+		return false
+	}
+}
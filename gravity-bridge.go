@@ -2,132 +2,133 @@ package main
 
 import (
 	"context"
-	"net/http"
-	"sync"
 	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
 	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"google.golang.org/grpc"
 )
 
-func GravityBridgeWalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
-	requestStart := time.Now()
+type GravityBridgeWalletCollector struct{}
 
-	sublogger := log.With().
-		Str("request_id", uuid.New().String()).
-		Logger()
+func NewGravityBridgeWalletCollector() *GravityBridgeWalletCollector {
+	return &GravityBridgeWalletCollector{}
+}
+
+func (c *GravityBridgeWalletCollector) Name() string {
+	return "gravity-bridge/wallet"
+}
+
+func (c *GravityBridgeWalletCollector) RequiredParams() []string {
+	return []string{"cudos_orchestrator_address", "ethereum_orchestrator_address"}
+}
 
-	cudosOrchestratorAddressParam := r.URL.Query().Get("cudos_orchestrator_address")
-	cudosOrchestratorAddress, err := sdk.AccAddressFromBech32(cudosOrchestratorAddressParam)
+func (c *GravityBridgeWalletCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	grpcConn := scrape.Upstream.GrpcConn
+	sublogger := scrape.Logger
+
+	cudosOrchestratorAddressParam := scrape.Params.Get("cudos_orchestrator_address")
+	cudosOrchestratorAddress, err := scrape.Chain.AccAddress(cudosOrchestratorAddressParam)
 	if err != nil {
 		sublogger.Error().
 			Str("cudos_orchestrator_address", cudosOrchestratorAddressParam).
 			Err(err).
 			Msg("Could not get cudos orchestrator address")
-		return
+		return &InvalidParamError{Param: "cudos_orchestrator_address", Err: err}
 	}
 
-	ethConn, err := ethclient.Dial(EthRPC)
+	ethConn, err := ethclient.DialContext(ctx, EthRPC)
 	if err != nil {
 		sublogger.Error().
 			Err(err).
 			Msg("Could not connect to Ethereum node")
-		return
+		return err
 	}
-	ethOrchestratorAddressParam := r.URL.Query().Get("ethereum_orchestrator_address")
+	ethOrchestratorAddressParam := scrape.Params.Get("ethereum_orchestrator_address")
 	ethOrchestratorAddress := common.HexToAddress(ethOrchestratorAddressParam)
 
-	gravCudoOrchBalanceGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "gravity_cudos_orchestrator_balance",
-			Help:        "Balance of the cudos orchestrator wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"cudos_orchestrator_address", "ethereum_orchestrator_address"},
+	gravCudoOrchBalanceGauge := scrape.NewGaugeVec(
+		"gravity_cudos_orchestrator_balance",
+		"Balance of the cudos orchestrator wallet",
+		"cudos_orchestrator_address", "ethereum_orchestrator_address",
 	)
 
-	gravEthOrchBalanceGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "gravity_ethereum_orchestrator_balance",
-			Help:        "Balance of the ethereum orchestrator wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"cudos_orchestrator_address", "ethereum_orchestrator_address"},
+	gravEthOrchBalanceGauge := scrape.NewGaugeVec(
+		"gravity_ethereum_orchestrator_balance",
+		"Balance of the ethereum orchestrator wallet",
+		"cudos_orchestrator_address", "ethereum_orchestrator_address",
 	)
 
-	gravEthOrchERC20BalanceGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "gravity_ethereum_orchestrator_erc20_balance",
-			Help:        "ERC20 balance of the ethereum orchestrator wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"cudos_orchestrator_address", "ethereum_orchestrator_address"},
+	gravEthOrchERC20BalanceGauge := scrape.NewGaugeVec(
+		"gravity_ethereum_orchestrator_erc20_balance",
+		"ERC20 balance of the ethereum orchestrator wallet",
+		"cudos_orchestrator_address", "ethereum_orchestrator_address",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(gravCudoOrchBalanceGauge)
-	registry.MustRegister(gravEthOrchBalanceGauge)
-	registry.MustRegister(gravEthOrchERC20BalanceGauge)
-
-	var wg sync.WaitGroup
-
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().
-			Str("cudos_orchestrator_address", cudosOrchestratorAddress.String()).
+			Str("cudos_orchestrator_address", cudosOrchestratorAddress).
 			Msg("Started querying orchestrator wallet balance")
 		queryStart := time.Now()
 
 		bankClient := banktypes.NewQueryClient(grpcConn)
-		bankRes, err := bankClient.AllBalances(
-			context.Background(),
-			&banktypes.QueryAllBalancesRequest{Address: cudosOrchestratorAddress.String()},
-		)
+		var balances []sdk.Coin
+		err := scrape.Paginate("bank/AllBalances", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			bankRes, err := bankClient.AllBalances(
+				ctx,
+				&banktypes.QueryAllBalancesRequest{Address: cudosOrchestratorAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			balances = append(balances, bankRes.Balances...)
+			return bankRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
-				Str("cudos_orchestrator_address", cudosOrchestratorAddress.String()).
+				Str("cudos_orchestrator_address", cudosOrchestratorAddress).
 				Err(err).
 				Msg("Could not get orchestrator balance")
-			return
+			return err
 		}
 
 		sublogger.Debug().
-			Str("cudos_orchestrator_address", cudosOrchestratorAddress.String()).
+			Str("cudos_orchestrator_address", cudosOrchestratorAddress).
 			Float64("request_time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying orchestrator balance")
 
-		for _, balance := range bankRes.Balances {
-			tokensRatio, _ := ToNativeBalance(balance.Amount.BigInt())
+		for _, balance := range balances {
+			tokensRatio := scrape.Chain.Denoms.BondIntAmount(balance.Amount)
 			gravCudoOrchBalanceGauge.With(prometheus.Labels{
-				"cudos_orchestrator_address":    cudosOrchestratorAddress.String(),
+				"cudos_orchestrator_address":    cudosOrchestratorAddress,
 				"ethereum_orchestrator_address": ethOrchestratorAddress.String(),
 			}).Set(tokensRatio)
 
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().
 			Str("ethereum_orchestrator_address", ethOrchestratorAddress.String()).
 			Msg("Started querying ethereum wallet balance")
 		queryStart := time.Now()
 
-		ethBal, err := ethConn.BalanceAt(context.Background(), ethOrchestratorAddress, nil)
+		ethCtx, cancel := context.WithTimeout(ctx, EthRPCTimeout)
+		defer cancel()
+
+		ethBal, err := ethConn.BalanceAt(ethCtx, ethOrchestratorAddress, nil)
 		if err != nil {
 			sublogger.Error().
 				Str("ethereum_orchestrator_address", ethOrchestratorAddress.String()).
 				Err(err).
 				Msg("Could not get ethereum balance")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -136,17 +137,16 @@ func GravityBridgeWalletHandler(w http.ResponseWriter, r *http.Request, grpcConn
 			Uint64("balance", ethBal.Uint64()).
 			Msg("Finished querying balance")
 
-		tokensRatio, _ := ToNativeBalance(ethBal)
+		tokensRatio := scrape.Chain.Denoms.BondAmount(sdk.NewDecFromBigInt(ethBal))
 
 		gravEthOrchBalanceGauge.With(prometheus.Labels{
-			"cudos_orchestrator_address":    cudosOrchestratorAddress.String(),
+			"cudos_orchestrator_address":    cudosOrchestratorAddress,
 			"ethereum_orchestrator_address": ethOrchestratorAddress.String(),
 		}).Set(tokensRatio)
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().
 			Str("ethereum_orchestrator_address", ethOrchestratorAddress.String()).
 			Msg("Started querying ethereum erc20 wallet balance")
@@ -159,16 +159,19 @@ func GravityBridgeWalletHandler(w http.ResponseWriter, r *http.Request, grpcConn
 			sublogger.Error().
 				Err(err).
 				Msg("Could not retrieve token contract")
-			return
+			return err
 		}
 
-		ethBal, err := instance.BalanceOf(&bind.CallOpts{}, ethOrchestratorAddress)
+		ethCtx, cancel := context.WithTimeout(ctx, EthRPCTimeout)
+		defer cancel()
+
+		ethBal, err := instance.BalanceOf(&bind.CallOpts{Context: ethCtx}, ethOrchestratorAddress)
 		if err != nil {
 			sublogger.Error().
 				Str("ethereum_token_address", ethTokenAddress.String()).
 				Err(err).
 				Msg("Could not get ethereum token balance")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -177,39 +180,41 @@ func GravityBridgeWalletHandler(w http.ResponseWriter, r *http.Request, grpcConn
 			Uint64("balance", ethBal.Uint64()).
 			Msg("Finished querying erc20 balance")
 
-		tokensRatio, _ := ToNativeBalance(ethBal)
+		tokensRatio := scrape.Chain.Denoms.BondAmount(sdk.NewDecFromBigInt(ethBal))
 
 		gravEthOrchERC20BalanceGauge.With(prometheus.Labels{
-			"cudos_orchestrator_address":    cudosOrchestratorAddress.String(),
+			"cudos_orchestrator_address":    cudosOrchestratorAddress,
 			"ethereum_orchestrator_address": ethOrchestratorAddress.String(),
 		}).Set(tokensRatio)
-	}()
-	wg.Add(1)
-
-	wg.Wait()
-
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/gravity-bridge/wallet?cudos_orchestrator_address="+cudosOrchestratorAddress.String()+"&ethereum_orchestrator_address="+ethOrchestratorAddress.String()).
-		Float64("request_time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+		return nil
+	})
+
+	return scrape.Wait()
+}
+
+type GravityBridgeContractCollector struct{}
+
+func NewGravityBridgeContractCollector() *GravityBridgeContractCollector {
+	return &GravityBridgeContractCollector{}
+}
+
+func (c *GravityBridgeContractCollector) Name() string {
+	return "gravity-bridge/contract"
 }
 
-func GravityBridgeContractHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
-	requestStart := time.Now()
+func (c *GravityBridgeContractCollector) RequiredParams() []string {
+	return nil
+}
 
-	sublogger := log.With().
-		Str("request_id", uuid.New().String()).
-		Logger()
+func (c *GravityBridgeContractCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
 
-	ethConn, err := ethclient.Dial(EthRPC)
+	ethConn, err := ethclient.DialContext(ctx, EthRPC)
 	if err != nil {
 		sublogger.Error().
 			Err(err).
 			Msg("Could not connect to Ethereum node")
-		return
+		return err
 	}
 
 	ethTokenAddress := common.HexToAddress(ethTokenContract)
@@ -219,33 +224,30 @@ func GravityBridgeContractHandler(w http.ResponseWriter, r *http.Request, grpcCo
 		sublogger.Error().
 			Err(err).
 			Msg("Could not retrieve token contract")
-		return
+		return err
 	}
 
-	gravEthContractBalanceGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "gravity_ethereum_contract_balance",
-			Help:        "Balance of the ethereum gravity contract",
-			ConstLabels: ConstLabels,
-		},
-		[]string{},
+	gravEthContractBalanceGauge := scrape.NewGaugeVec(
+		"gravity_ethereum_contract_balance",
+		"Balance of the ethereum gravity contract",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(gravEthContractBalanceGauge)
-
 	sublogger.Debug().
 		Str("ethereum_gravity_contract", ethTokenAddress.String()).
 		Msg("Started querying gravity ethereum gravity contract balance")
 	queryStart := time.Now()
 	gravityAddress := common.HexToAddress(ethGravityContract)
-	ethBal, err := instance.BalanceOf(&bind.CallOpts{}, gravityAddress)
+
+	ethCtx, cancel := context.WithTimeout(ctx, EthRPCTimeout)
+	defer cancel()
+
+	ethBal, err := instance.BalanceOf(&bind.CallOpts{Context: ethCtx}, gravityAddress)
 	if err != nil {
 		sublogger.Error().
 			Str("ethereum_token_address", ethTokenAddress.String()).
 			Err(err).
 			Msg("Could not get ethereum token balance")
-		return
+		return err
 	}
 
 	sublogger.Debug().
@@ -253,14 +255,8 @@ func GravityBridgeContractHandler(w http.ResponseWriter, r *http.Request, grpcCo
 		Float64("request_time", time.Since(queryStart).Seconds()).
 		Msg("Finished querying gravity ethereum contract token balance")
 
-	tokensRatio, _ := ToNativeBalance(ethBal)
+	tokensRatio := scrape.Chain.Denoms.BondAmount(sdk.NewDecFromBigInt(ethBal))
 	gravEthContractBalanceGauge.With(nil).Set(tokensRatio)
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/gravity-bridge/contract").
-		Float64("request_time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+	return nil
 }
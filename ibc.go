@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	ibctransfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DenomTrace is where a denom comes from. For the denoms native to the chain,
+// BaseDenom is the denom itself and Path and SourceChannel are empty.
+type DenomTrace struct {
+	BaseDenom     string
+	Path          string
+	SourceChannel string
+}
+
+// Labels returns the labels describing the trace of the denom in the metrics.
+func (t DenomTrace) Labels() prometheus.Labels {
+	return prometheus.Labels{
+		"base_denom":     t.BaseDenom,
+		"path":           t.Path,
+		"source_channel": t.SourceChannel,
+	}
+}
+
+// DenomTraces caches the traces of the IBC denoms (ibc/<hash>) of a chain. A trace never changes,
+// so the trace of a denom is only fetched the first time it shows up.
+type DenomTraces struct {
+	mutex  sync.Mutex
+	traces map[string]DenomTrace
+	// the IBC denoms the node has no trace for, not to fetch them again on every scrape
+	unknown map[string]bool
+}
+
+func NewDenomTraces() *DenomTraces {
+	return &DenomTraces{
+		traces:  make(map[string]DenomTrace),
+		unknown: make(map[string]bool),
+	}
+}
+
+// IsIBCDenom returns true if the denom is an IBC voucher.
+func IsIBCDenom(denom string) bool {
+	return strings.HasPrefix(denom, ibctransfertypes.DenomPrefix+"/")
+}
+
+// missing returns the IBC denoms given which have no cached trace and are not known to have none.
+func (t *DenomTraces) missing(denoms []string) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var missing []string
+	for _, denom := range denoms {
+		if _, ok := t.traces[denom]; !ok && IsIBCDenom(denom) && !t.unknown[denom] {
+			missing = append(missing, denom)
+		}
+	}
+
+	return missing
+}
+
+// Resolve makes sure the traces of all the IBC denoms given are cached, fetching the missing ones
+// one by one. The traces fetched are cached even if others failed, the first error is returned.
+func (t *DenomTraces) Resolve(ctx context.Context, scrape *Scrape, grpcConn *grpc.ClientConn, denoms []string) error {
+	missing := t.missing(denoms)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sublogger := scrape.Logger
+	sublogger.Debug().Int("denoms", len(missing)).Msg("Started querying IBC denom traces")
+	queryStart := time.Now()
+
+	var firstErr error
+
+	transferClient := ibctransfertypes.NewQueryClient(grpcConn)
+	for _, denom := range missing {
+		response, err := transferClient.DenomTrace(
+			ctx,
+			&ibctransfertypes.QueryDenomTraceRequest{Hash: strings.TrimPrefix(denom, ibctransfertypes.DenomPrefix+"/")},
+		)
+
+		// the node answers the same for a hash it has no trace for, no need to ask again
+		if code := status.Code(err); code == codes.NotFound || code == codes.InvalidArgument {
+			sublogger.Warn().Str("denom", denom).Err(err).Msg("Could not find the trace of IBC denom")
+
+			t.mutex.Lock()
+			t.unknown[denom] = true
+			t.mutex.Unlock()
+			continue
+		}
+
+		if err != nil {
+			sublogger.Error().Str("denom", denom).Err(err).Msg("Could not get IBC denom trace")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if response.DenomTrace == nil {
+			continue
+		}
+
+		t.mutex.Lock()
+		t.traces[denom] = NewDenomTrace(*response.DenomTrace)
+		t.mutex.Unlock()
+	}
+
+	sublogger.Debug().
+		Float64("request-time", time.Since(queryStart).Seconds()).
+		Msg("Finished querying IBC denom traces")
+
+	return firstErr
+}
+
+// Get returns the cached trace of the denom. The denoms without a trace are their own base denom.
+func (t *DenomTraces) Get(denom string) DenomTrace {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if trace, ok := t.traces[denom]; ok {
+		return trace
+	}
+
+	return DenomTrace{BaseDenom: denom}
+}
+
+// NewDenomTrace converts an IBC transfer trace. Its path is a list of port/channel pairs, the first one
+// being the channel of this chain the tokens were received on.
+func NewDenomTrace(trace ibctransfertypes.DenomTrace) DenomTrace {
+	denomTrace := DenomTrace{BaseDenom: trace.BaseDenom, Path: trace.Path}
+
+	if identifiers := strings.Split(trace.Path, "/"); len(identifiers) >= 2 {
+		denomTrace.SourceChannel = identifiers[1]
+	}
+
+	return denomTrace
+}
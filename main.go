@@ -1,20 +1,17 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"math"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
-	sdk "github.com/cosmos/cosmos-sdk/types"
-	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	tmrpc "github.com/tendermint/tendermint/rpc/client/http"
-	"google.golang.org/grpc"
 )
 
 var (
@@ -22,15 +19,31 @@ var (
 
 	Denom              string
 	ListenAddress      string
-	NodeAddress        string
-	TendermintRPC      string
+	NodeAddresses      []string
+	TendermintRPCs     []string
+	ReferenceRPC       string
 	OsmosisAPI         string
 	EthRPC             string
+	OptionalNetworks   map[string]string
 	ethTokenContract   string
 	ethGravityContract string
-	OptionalNetworks   map[string]string
 	LogLevel           string
 	Limit              uint64
+	MaxPages           int
+	RefreshInterval    time.Duration
+	RefreshIntervals   map[string]string
+
+	GrpcTimeout          time.Duration
+	TendermintRPCTimeout time.Duration
+	EthRPCTimeout        time.Duration
+	RestTimeout          time.Duration
+
+	RoundRobin          bool
+	HealthCheckInterval time.Duration
+	BlockStallTimeout   time.Duration
+	SigningWindow       int
+
+	EnabledCollectorNames []string
 
 	Prefix                    string
 	AccountPrefix             string
@@ -40,9 +53,9 @@ var (
 	ConsensusNodePrefix       string
 	ConsensusNodePubkeyPrefix string
 
-	ChainID          string
-	ConstLabels      map[string]string
 	DenomCoefficient float64
+	DenomsConfigPath string
+	DenomOverrides   map[string]DenomUnit
 
 	TokenPrices []string
 )
@@ -73,7 +86,7 @@ var rootCmd = &cobra.Command{
 		cmd.Flags().VisitAll(func(f *pflag.Flag) {
 			if !f.Changed && viper.IsSet(f.Name) {
 				val := viper.Get(f.Name)
-				if err := cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val)); err != nil {
+				if err := cmd.Flags().Set(f.Name, configValueToFlag(val)); err != nil {
 					log.Fatal().Err(err).Msg("Could not set flag")
 				}
 			}
@@ -86,6 +99,31 @@ var rootCmd = &cobra.Command{
 	Run: Execute,
 }
 
+// configValueToFlag formats a config value the way pflag expects it on the command line,
+// so list and map values like "node" or "refresh-intervals" can be set from the config file as well.
+func configValueToFlag(val interface{}) string {
+	if list, ok := val.([]interface{}); ok {
+		items := make([]string, len(list))
+		for index, item := range list {
+			items[index] = fmt.Sprintf("%v", item)
+		}
+
+		return strings.Join(items, ",")
+	}
+
+	values, ok := val.(map[string]interface{})
+	if !ok {
+		return fmt.Sprintf("%v", val)
+	}
+
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
 func setBechPrefixes(cmd *cobra.Command) {
 	if flag, err := cmd.Flags().GetString("bech-account-prefix"); flag != "" && err == nil {
 		AccountPrefix = flag
@@ -131,7 +169,6 @@ func Execute(cmd *cobra.Command, args []string) {
 	}
 
 	zerolog.SetGlobalLevel(logLevel)
-	fmt.Println(OptionalNetworks["osmosis"])
 	log.Info().
 		Str("--bech-account-prefix", AccountPrefix).
 		Str("--bech-account-pubkey-prefix", AccountPubkeyPrefix).
@@ -141,65 +178,85 @@ func Execute(cmd *cobra.Command, args []string) {
 		Str("--bech-consensus-node-pubkey-prefix", ConsensusNodePubkeyPrefix).
 		Str("--denom", Denom).
 		Str("--listen-address", ListenAddress).
-		Str("--node", NodeAddress).
+		Strs("--node", NodeAddresses).
+		Strs("--tendermint-rpc", TendermintRPCs).
+		Str("--reference-tendermint-rpc", ReferenceRPC).
+		Bool("--round-robin", RoundRobin).
+		Dur("--health-check-interval", HealthCheckInterval).
+		Dur("--block-stall-timeout", BlockStallTimeout).
+		Int("--signing-window", SigningWindow).
 		Str("--eth-node", EthRPC).
 		Str("--eth-token-contract", ethTokenContract).
 		Str("--eth-gravity-contract", ethGravityContract).
 		Str("--log-level", LogLevel).
+		Dur("--refresh-interval", RefreshInterval).
+		Dur("--grpc-timeout", GrpcTimeout).
+		Dur("--tendermint-rpc-timeout", TendermintRPCTimeout).
+		Dur("--eth-rpc-timeout", EthRPCTimeout).
+		Dur("--rest-timeout", RestTimeout).
 		Msg("Started with following parameters")
 
-	config := sdk.GetConfig()
-	config.SetBech32PrefixForAccount(AccountPrefix, AccountPubkeyPrefix)
-	config.SetBech32PrefixForValidator(ValidatorPrefix, ValidatorPubkeyPrefix)
-	config.SetBech32PrefixForConsensusNode(ConsensusNodePrefix, ConsensusNodePubkeyPrefix)
-	// config.Seal()
-
-	grpcConn, err := grpc.Dial(
-		NodeAddress,
-		grpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Could not connect to gRPC node")
+	// the uptime is computed over a ring of this many blocks, which is also how far the blocks are backfilled
+	if SigningWindow < 1 {
+		log.Fatal().Int("--signing-window", SigningWindow).Msg("The signing window must be at least 1 block")
 	}
 
-	setChainID()
-	setDenom(grpcConn)
+	exporterMetrics := NewExporterMetrics()
 
-	http.HandleFunc("/metrics/wallet", func(w http.ResponseWriter, r *http.Request) {
-		WalletHandler(w, r, grpcConn)
-	})
+	DenomOverrides, err = LoadDenomOverrides(DenomsConfigPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not load denoms config")
+	}
 
-	http.HandleFunc("/metrics/validator", func(w http.ResponseWriter, r *http.Request) {
-		ValidatorHandler(w, r, grpcConn)
-	})
+	chainConfigs, err := loadChainConfigs()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not load chains config")
+	}
 
-	http.HandleFunc("/metrics/validators", func(w http.ResponseWriter, r *http.Request) {
-		ValidatorsHandler(w, r, grpcConn)
-	})
+	chainsList := make([]*Chain, 0, len(chainConfigs))
+	for _, chainConfig := range chainConfigs {
+		chain, err := NewChain(chainConfig, exporterMetrics)
+		if err != nil {
+			log.Fatal().
+				Str("chain", chainConfig.Name).
+				Err(err).
+				Msg("Could not set up chain")
+		}
 
-	http.HandleFunc("/metrics/params", func(w http.ResponseWriter, r *http.Request) {
-		ParamsHandler(w, r, grpcConn)
-	})
+		log.Info().
+			Str("chain", chain.Name).
+			Str("chain-id", chain.ChainID).
+			Strs("nodes", chain.Nodes).
+			Str("denom", chain.Denoms.Denom).
+			Msg("Monitoring chain")
+		chainsList = append(chainsList, chain)
+	}
 
-	http.HandleFunc("/metrics/general", func(w http.ResponseWriter, r *http.Request) {
-		GeneralHandler(w, r, grpcConn)
-	})
+	chains, err := NewChains(chainsList)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not set up chains")
+	}
 
-	http.HandleFunc("/metrics/gravity-bridge/wallet", func(w http.ResponseWriter, r *http.Request) {
-		GravityBridgeWalletHandler(w, r, grpcConn)
-	})
+	networks, err := loadNetworks(exporterMetrics)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not set up networks")
+	}
 
-	http.HandleFunc("/metrics/gravity-bridge/contract", func(w http.ResponseWriter, r *http.Request) {
-		GravityBridgeContractHandler(w, r, grpcConn)
-	})
+	collectors, err := EnabledCollectors(NewCollectors(networks), EnabledCollectorNames)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not enable collectors")
+	}
 
-	http.HandleFunc("/metrics/status", func(w http.ResponseWriter, r *http.Request) {
-		StatusHandler(w, r, grpcConn)
-	})
+	scheduler := NewScheduler(chains, RefreshInterval, parseRefreshIntervals(), exporterMetrics)
+	for _, collector := range collectors {
+		log.Info().Str("collector", collector.Name()).Msg("Enabled collector")
+		http.Handle(
+			"/metrics/"+collector.Name(),
+			exporterMetrics.InstrumentHandler(collector.Name(), scheduler.Handler(collector)),
+		)
+	}
 
-	http.HandleFunc("/metrics/osmosis", func(w http.ResponseWriter, r *http.Request) {
-		OsmosisHandler(w, r)
-	})
+	http.Handle("/metrics", exporterMetrics.Handler())
 
 	log.Info().Str("address", ListenAddress).Msg("Listening")
 	err = http.ListenAndServe(ListenAddress, nil)
@@ -208,81 +265,146 @@ func Execute(cmd *cobra.Command, args []string) {
 	}
 }
 
-func setChainID() {
-	client, err := tmrpc.New(TendermintRPC, "/websocket")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Could not create Tendermint client")
+func parseRefreshIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration, len(RefreshIntervals))
+
+	for name, value := range RefreshIntervals {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatal().
+				Str("collector", name).
+				Err(err).
+				Msg("Could not parse refresh interval")
+		}
+
+		intervals[name] = interval
 	}
 
-	status, err := client.Status(context.Background())
-	if err != nil {
-		log.Fatal().Err(err).Msg("Could not query Tendermint status")
+	return intervals
+}
+
+// loadChainConfigs returns the chains listed in the config file,
+// or a single chain set up with the flags if there are none.
+func loadChainConfigs() ([]ChainConfig, error) {
+	if !viper.IsSet("chains") {
+		return []ChainConfig{
+			{
+				Nodes:                     NodeAddresses,
+				TendermintRPCs:            TendermintRPCs,
+				ReferenceRPC:              ReferenceRPC,
+				RoundRobin:                RoundRobin,
+				Denom:                     Denom,
+				DenomCoefficient:          DenomCoefficient,
+				BechPrefix:                Prefix,
+				AccountPrefix:             AccountPrefix,
+				AccountPubkeyPrefix:       AccountPubkeyPrefix,
+				ValidatorPrefix:           ValidatorPrefix,
+				ValidatorPubkeyPrefix:     ValidatorPubkeyPrefix,
+				ConsensusNodePrefix:       ConsensusNodePrefix,
+				ConsensusNodePubkeyPrefix: ConsensusNodePubkeyPrefix,
+			},
+		}, nil
 	}
 
-	log.Info().Str("network", status.NodeInfo.Network).Msg("Got network status from Tendermint")
-	ChainID = status.NodeInfo.Network
-	ConstLabels = map[string]string{
-		"chain_id": ChainID,
+	var chainConfigs []ChainConfig
+	if err := viper.UnmarshalKey("chains", &chainConfigs); err != nil {
+		return nil, err
 	}
-}
 
-func setDenom(grpcConn *grpc.ClientConn) {
-	// if --denom and --denom-coefficient are both provided, use them
-	// instead of fetching them via gRPC. Can be useful for networks like osmosis.
-	if Denom != "" && DenomCoefficient != 0 {
-		log.Info().
-			Str("denom", Denom).
-			Float64("coefficient", DenomCoefficient).
-			Msg("Using provided denom and coefficient.")
-		return
+	for index, chainConfig := range chainConfigs {
+		if len(chainConfig.Nodes) == 0 || len(chainConfig.TendermintRPCs) == 0 || chainConfig.BechPrefix == "" {
+			return nil, fmt.Errorf("chain #%d: node, tendermint-rpc and bech-prefix are required", index)
+		}
 	}
 
-	bankClient := banktypes.NewQueryClient(grpcConn)
-	denoms, err := bankClient.DenomsMetadata(
-		context.Background(),
-		&banktypes.QueryDenomsMetadataRequest{},
-	)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error querying denom")
+	return chainConfigs, nil
+}
+
+// loadNetworkConfigs returns the networks listed in the config file, followed by the ones of the deprecated
+// --optional-networks flag. The flag only sets the node of a network, its addresses have the account prefix
+// of the chain as they used to.
+func loadNetworkConfigs() ([]NetworkConfig, error) {
+	var networkConfigs []NetworkConfig
+	if err := viper.UnmarshalKey("networks", &networkConfigs); err != nil {
+		return nil, err
 	}
 
-	if len(denoms.Metadatas) == 0 {
-		log.Fatal().Msg("No denom infos. Try running the binary with --denom and --denom-coefficient to set them manually.")
+	names := make([]string, 0, len(OptionalNetworks))
+	for name := range OptionalNetworks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		log.Warn().
+			Str("network", name).
+			Str("node", OptionalNetworks[name]).
+			Msg("--optional-networks is deprecated, list the network in the networks section of the config file instead")
+
+		networkConfigs = append(networkConfigs, NetworkConfig{
+			Name:          name,
+			Node:          OptionalNetworks[name],
+			BechPrefix:    Prefix,
+			AccountPrefix: AccountPrefix,
+		})
 	}
 
-	metadata := denoms.Metadatas[0] // always using the first one
-	if Denom == "" {                // using display currency
-		Denom = metadata.Display
+	return networkConfigs, nil
+}
+
+// loadNetworks connects to the networks listed in the config file.
+func loadNetworks(metrics *ExporterMetrics) (Networks, error) {
+	networkConfigs, err := loadNetworkConfigs()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, unit := range metadata.DenomUnits {
-		log.Debug().
-			Str("denom", unit.Denom).
-			Uint32("exponent", unit.Exponent).
-			Msg("Denom info")
-		if unit.Denom == Denom {
-			DenomCoefficient = math.Pow10(int(unit.Exponent))
-			log.Info().
-				Str("denom", Denom).
-				Float64("coefficient", DenomCoefficient).
-				Msg("Got denom info")
-			return
+	networks := make(Networks, len(networkConfigs))
+	for index, networkConfig := range networkConfigs {
+		if _, ok := networks[networkConfig.Name]; ok {
+			return nil, fmt.Errorf("network %q is configured twice", networkConfig.Name)
+		}
+
+		network, err := NewNetwork(networkConfig, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("network #%d: %w", index, err)
 		}
+
+		log.Info().
+			Str("network", network.Name).
+			Str("node", network.Node).
+			Str("denom", network.Denoms.Denom).
+			Msg("Added network")
+		networks[network.Name] = network
 	}
 
-	log.Fatal().Msg("Could not find the denom info")
+	return networks, nil
 }
 
 func main() {
 	rootCmd.PersistentFlags().StringVar(&ConfigPath, "config", "/var/lib/cosmos/config.json", "Config file path")
 	rootCmd.PersistentFlags().StringVar(&Denom, "denom", "", "Cosmos coin denom")
 	rootCmd.PersistentFlags().Float64Var(&DenomCoefficient, "denom-coefficient", 0, "Denom coefficient")
+	rootCmd.PersistentFlags().StringVar(&DenomsConfigPath, "denoms-config", "", "Config file overriding the display units of the denoms")
 	rootCmd.PersistentFlags().StringVar(&ListenAddress, "listen-address", ":9300", "The address this exporter would listen on")
-	rootCmd.PersistentFlags().StringVar(&NodeAddress, "node", "localhost:9090", "RPC node address")
+	rootCmd.PersistentFlags().StringSliceVar(&NodeAddresses, "node", []string{"localhost:9090"}, "gRPC node addresses, the first healthy one is queried")
 	rootCmd.PersistentFlags().StringVar(&LogLevel, "log-level", "info", "Logging level")
 	rootCmd.PersistentFlags().Uint64Var(&Limit, "limit", 1000, "Pagination limit for gRPC requests")
-	rootCmd.PersistentFlags().StringVar(&TendermintRPC, "tendermint-rpc", "http://localhost:26657", "Tendermint RPC address")
-	rootCmd.PersistentFlags().StringToStringVar(&OptionalNetworks, "optional-networks", nil, "Optional grpc networks")
+	rootCmd.PersistentFlags().IntVar(&MaxPages, "max-pages", 100, "Maximum number of pages fetched for a single paginated gRPC query")
+	rootCmd.PersistentFlags().DurationVar(&RefreshInterval, "refresh-interval", 0, "Interval to refresh the metrics in the background at, 0 to query the node on every scrape")
+	rootCmd.PersistentFlags().StringToStringVar(&RefreshIntervals, "refresh-intervals", nil, "Per-collector refresh intervals overriding --refresh-interval, e.g. validators=1m,status=5s")
+	rootCmd.PersistentFlags().StringSliceVar(&EnabledCollectorNames, "collectors", nil, "Collectors to enable, all of them if not set")
+	rootCmd.PersistentFlags().DurationVar(&GrpcTimeout, "grpc-timeout", 10*time.Second, "Timeout of a single gRPC query, 0 to only rely on the scrape timeout")
+	rootCmd.PersistentFlags().DurationVar(&TendermintRPCTimeout, "tendermint-rpc-timeout", 10*time.Second, "Timeout of a single Tendermint RPC query")
+	rootCmd.PersistentFlags().DurationVar(&EthRPCTimeout, "eth-rpc-timeout", 10*time.Second, "Timeout of a single Ethereum RPC query")
+	rootCmd.PersistentFlags().DurationVar(&RestTimeout, "rest-timeout", 10*time.Second, "Timeout of a single query to a REST API (Osmosis LCD, CoinGecko)")
+	rootCmd.PersistentFlags().StringSliceVar(&TendermintRPCs, "tendermint-rpc", []string{"http://localhost:26657"}, "Tendermint RPC addresses, in the same order as the gRPC node addresses")
+	rootCmd.PersistentFlags().StringVar(&ReferenceRPC, "reference-tendermint-rpc", "", "Tendermint RPC address of a node the height of the nodes is compared to, e.g. a public node")
+	rootCmd.PersistentFlags().BoolVar(&RoundRobin, "round-robin", false, "Spread the scrapes over all the healthy nodes instead of querying the first one")
+	rootCmd.PersistentFlags().DurationVar(&HealthCheckInterval, "health-check-interval", 10*time.Second, "Interval to check the status of the nodes at")
+	rootCmd.PersistentFlags().DurationVar(&BlockStallTimeout, "block-stall-timeout", time.Minute, "Time without a new block after which the exporter subscribes again to the new blocks")
+	rootCmd.PersistentFlags().IntVar(&SigningWindow, "signing-window", 1000, "Number of blocks the uptime of the validators is computed over")
+	rootCmd.PersistentFlags().StringToStringVar(&OptionalNetworks, "optional-networks", nil, "Deprecated, use the networks section of the config file: gRPC node addresses of the networks to query the wallets on, by name")
 	rootCmd.PersistentFlags().StringVar(&EthRPC, "eth-rpc", "http://localhost:8545", "Ethereum RPC address")
 	rootCmd.PersistentFlags().StringVar(&ethTokenContract, "eth-token-contract", "", "Ethereum token contract")
 	rootCmd.PersistentFlags().StringVar(&ethGravityContract, "eth-gravity-contract", "", "Ethereum gravity contract")
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the maximum number of unconfirmed txs the Tendermint RPC /unconfirmed_txs endpoint returns
+const maxUnconfirmedTxs = 100
+
+type UnconfirmedTxsResponse struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		NTxs       string   `json:"n_txs"`
+		Total      string   `json:"total"`
+		TotalBytes string   `json:"total_bytes"`
+		Txs        []string `json:"txs"`
+	} `json:"result"`
+}
+
+type MempoolCollector struct{}
+
+func NewMempoolCollector() *MempoolCollector {
+	return &MempoolCollector{}
+}
+
+func (c *MempoolCollector) Name() string {
+	return "mempool"
+}
+
+func (c *MempoolCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *MempoolCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	// the txs are only decoded if a limit is set, as they can be large
+	var limit int
+	if limitParam := scrape.Params.Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxUnconfirmedTxs {
+			return &InvalidParamError{
+				Param: "limit",
+				Err:   fmt.Errorf("expected a number of txs between 1 and %d, got %q", maxUnconfirmedTxs, limitParam),
+			}
+		}
+	}
+
+	mempoolTxsGauge := scrape.NewGauge(
+		"cosmos_mempool_txs",
+		"Number of txs in the mempool of the node",
+	)
+
+	mempoolBytesGauge := scrape.NewGauge(
+		"cosmos_mempool_bytes",
+		"Total size of the txs in the mempool of the node, in bytes",
+	)
+
+	scrape.Go(func() error {
+		sublogger.Debug().Msg("Started querying number of unconfirmed txs")
+		queryStart := time.Now()
+
+		body, err := HTTPGet(ctx, scrape.Chain.HTTPClient, scrape.Upstream.TendermintRPC+"/num_unconfirmed_txs")
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Error getting the num_unconfirmed_txs")
+			return err
+		}
+
+		unconfirmedTxsResponse := UnconfirmedTxsResponse{}
+		if err := json.Unmarshal(body, &unconfirmedTxsResponse); err != nil {
+			sublogger.Error().Err(err).Msg("Error unmarshalling the num_unconfirmed_txs json response")
+			return err
+		}
+
+		sublogger.Debug().
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying number of unconfirmed txs")
+
+		total, err := strconv.ParseInt(unconfirmedTxsResponse.Result.Total, 10, 64)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not parse the number of unconfirmed txs")
+			return err
+		}
+
+		totalBytes, err := strconv.ParseInt(unconfirmedTxsResponse.Result.TotalBytes, 10, 64)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not parse the size of the unconfirmed txs")
+			return err
+		}
+
+		mempoolTxsGauge.Set(float64(total))
+		mempoolBytesGauge.Set(float64(totalBytes))
+		return nil
+	})
+
+	if limit > 0 {
+		decodedTxsGauge := scrape.NewGauge(
+			"cosmos_mempool_decoded_txs",
+			"Number of txs of the mempool decoded for the messages breakdown",
+		)
+
+		undecodableTxsGauge := scrape.NewGauge(
+			"cosmos_mempool_undecodable_txs",
+			"Number of txs of the mempool which could not be decoded, e.g. amino encoded ones",
+		)
+
+		messagesGauge := scrape.NewGaugeVec(
+			"cosmos_mempool_messages",
+			"Number of messages in the decoded txs of the mempool, by type URL",
+			"type",
+		)
+
+		scrape.Go(func() error {
+			sublogger.Debug().Msg("Started querying unconfirmed txs")
+			queryStart := time.Now()
+
+			body, err := HTTPGet(ctx, scrape.Chain.HTTPClient, fmt.Sprintf(
+				"%s/unconfirmed_txs?limit=%d",
+				scrape.Upstream.TendermintRPC,
+				limit,
+			))
+			if err != nil {
+				sublogger.Error().Err(err).Msg("Error getting the unconfirmed_txs")
+				return err
+			}
+
+			unconfirmedTxsResponse := UnconfirmedTxsResponse{}
+			if err := json.Unmarshal(body, &unconfirmedTxsResponse); err != nil {
+				sublogger.Error().Err(err).Msg("Error unmarshalling the unconfirmed_txs json response")
+				return err
+			}
+
+			sublogger.Debug().
+				Float64("request-time", time.Since(queryStart).Seconds()).
+				Msg("Finished querying unconfirmed txs")
+
+			var decoded, undecodable int
+			messages := make(map[string]int)
+
+			for _, tx := range unconfirmedTxsResponse.Result.Txs {
+				txBytes, err := base64.StdEncoding.DecodeString(tx)
+				if err != nil {
+					undecodable++
+					continue
+				}
+
+				decodedTx, err := DecodeTx(txBytes)
+				if err != nil {
+					undecodable++
+					continue
+				}
+
+				decoded++
+				for _, messageType := range decodedTx.MessageTypes {
+					messages[messageType]++
+				}
+			}
+
+			decodedTxsGauge.Set(float64(decoded))
+			undecodableTxsGauge.Set(float64(undecodable))
+
+			for messageType, count := range messages {
+				messagesGauge.With(prometheus.Labels{"type": messageType}).Set(float64(count))
+			}
+
+			return nil
+		})
+	}
+
+	return scrape.Wait()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// NetworkConfig is another network the wallets can be queried on with the network query param,
+// as listed in the "networks" section of the config file.
+type NetworkConfig struct {
+	Name             string  `mapstructure:"name"`
+	Node             string  `mapstructure:"node"`
+	Denom            string  `mapstructure:"denom"`
+	DenomCoefficient float64 `mapstructure:"denom-coefficient"`
+	BechPrefix       string  `mapstructure:"bech-prefix"`
+	AccountPrefix    string  `mapstructure:"bech-account-prefix"`
+}
+
+// Network is a connection to another network, created once and shared by all the scrapes.
+type Network struct {
+	NetworkConfig
+
+	GrpcConn     *grpc.ClientConn
+	Denoms       *Denoms
+	DenomTraces  *DenomTraces
+	Capabilities *Capabilities
+}
+
+// NewNetwork connects to the node of the network and fetches its denoms.
+func NewNetwork(config NetworkConfig, metrics *ExporterMetrics) (*Network, error) {
+	if config.Name == "" || config.Node == "" || config.BechPrefix == "" {
+		return nil, fmt.Errorf("name, node and bech-prefix are required")
+	}
+
+	if config.AccountPrefix == "" {
+		config.AccountPrefix = config.BechPrefix
+	}
+
+	grpcConn, err := grpc.Dial(
+		config.Node,
+		grpc.WithInsecure(),
+		grpc.WithChainUnaryInterceptor(
+			metrics.UnaryClientInterceptor(config.Name),
+			GrpcTimeoutInterceptor(GrpcTimeout),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to gRPC node %s: %w", config.Node, err)
+	}
+
+	denoms, err := fetchDenoms(grpcConn, config.Denom, config.DenomCoefficient)
+	if err != nil {
+		grpcConn.Close()
+		return nil, err
+	}
+
+	return &Network{
+		NetworkConfig: config,
+		GrpcConn:      grpcConn,
+		Denoms:        denoms,
+		DenomTraces:   NewDenomTraces(),
+		Capabilities:  NewCapabilities(),
+	}, nil
+}
+
+// AccAddress checks the account address belongs to the network and returns it normalized.
+func (n *Network) AccAddress(address string) (string, error) {
+	return normalizeBech32(address, n.AccountPrefix)
+}
+
+// Networks are the other networks the wallets can be queried on, by name.
+type Networks map[string]*Network
+
+// Get returns the network with that name, or an InvalidParamError if there's none.
+func (n Networks) Get(name string) (*Network, error) {
+	network, ok := n[name]
+	if !ok {
+		return nil, &InvalidParamError{Param: "network", Err: fmt.Errorf("unknown network %q", name)}
+	}
+
+	return network, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadNetworkConfigsOptionalNetworks(t *testing.T) {
+	defer func(optionalNetworks map[string]string, prefix, accountPrefix string) {
+		OptionalNetworks, Prefix, AccountPrefix = optionalNetworks, prefix, accountPrefix
+		viper.Reset()
+	}(OptionalNetworks, Prefix, AccountPrefix)
+
+	viper.Set("networks", []map[string]interface{}{
+		{"name": "juno", "node": "juno-node:9090", "bech-prefix": "juno"},
+	})
+	OptionalNetworks = map[string]string{"osmosis": "osmosis-node:9090", "akash": "akash-node:9090"}
+	Prefix, AccountPrefix = "cosmos", "cosmos"
+
+	networkConfigs, err := loadNetworkConfigs()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	expected := []NetworkConfig{
+		{Name: "juno", Node: "juno-node:9090", BechPrefix: "juno"},
+		{Name: "akash", Node: "akash-node:9090", BechPrefix: "cosmos", AccountPrefix: "cosmos"},
+		{Name: "osmosis", Node: "osmosis-node:9090", BechPrefix: "cosmos", AccountPrefix: "cosmos"},
+	}
+
+	if !reflect.DeepEqual(networkConfigs, expected) {
+		t.Errorf("got %+v, expected %+v", networkConfigs, expected)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,118 +9,98 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/google/uuid"
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func OsmosisHandler(w http.ResponseWriter, r *http.Request) {
-	requestStart := time.Now()
+type OsmosisCollector struct{}
 
-	sublogger := log.With().
-		Str("request_id", uuid.New().String()).
-		Logger()
+func NewOsmosisCollector() *OsmosisCollector {
+	return &OsmosisCollector{}
+}
+
+func (c *OsmosisCollector) Name() string {
+	return "osmosis"
+}
+
+func (c *OsmosisCollector) RequiredParams() []string {
+	return []string{"pool_id"}
+}
+
+func (c *OsmosisCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
 
-	poolId := r.URL.Query().Get("pool_id")
-	priceDenoms := r.URL.Query().Get("price_denoms")
+	poolId := scrape.Params.Get("pool_id")
+	priceDenoms := scrape.Params.Get("price_denoms")
 
 	// Get osmosis data
 	client := newRestClient("lcd-osmosis.blockapsis.com")
 
-	wg := new(sync.WaitGroup)
-
 	osmosisPoolRes := poolResponse{}
 	osmosisTotalLiquidityRes := totalLiquidityResponse{}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		res, err := client.getPool(poolId)
+	scrape.Go(func() error {
+		res, err := client.getPool(ctx, poolId)
 		if err != nil {
 			sublogger.Error().
 				Err(err).
 				Msg("Issue retreiving the pool")
+			return err
 		}
 		osmosisPoolRes = res
-	}()
+		return nil
+	})
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		res, err := client.getTotalLiquidity(poolId)
+	scrape.Go(func() error {
+		res, err := client.getTotalLiquidity(ctx, poolId)
 		if err != nil {
 			sublogger.Error().
 				Err(err).
 				Msg("Could not retrieve pools total liquidity")
+			return err
 		}
 		osmosisTotalLiquidityRes = res
-	}()
+		return nil
+	})
 
-	wg.Wait()
+	// the errors are returned by the scrape.Wait() below as well
+	_ = scrape.Wait()
 
 	// Create and register metrics
-	osmosisSwapFee := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "osmosis_swap_fee",
-			Help:        "",
-			ConstLabels: ConstLabels,
-		},
+	osmosisSwapFee := scrape.NewGauge(
+		"osmosis_swap_fee",
+		"",
 	)
 
-	osmosisExitFee := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "osmosis_exit_fee",
-			Help:        "",
-			ConstLabels: ConstLabels,
-		},
+	osmosisExitFee := scrape.NewGauge(
+		"osmosis_exit_fee",
+		"",
 	)
 
-	osmosisPoolWeight := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "osmosis_pool_weight",
-			Help:        "",
-			ConstLabels: ConstLabels,
-		},
+	osmosisPoolWeight := scrape.NewGauge(
+		"osmosis_pool_weight",
+		"",
 	)
 
-	osmosisAssetWeight := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "osmosis_pool_asset_weight",
-			Help:        "",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"denom"},
+	osmosisAssetWeight := scrape.NewGaugeVec(
+		"osmosis_pool_asset_weight",
+		"",
+		"denom",
 	)
 
-	osmosisAssetAmount := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "osmosis_pool_asset_amount",
-			Help:        "",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"denom"},
+	osmosisAssetAmount := scrape.NewGaugeVec(
+		"osmosis_pool_asset_amount",
+		"",
+		"denom", "display",
 	)
 
-	osmosisTotalPoolShares := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "osmosis_total_pool_shares",
-			Help:        "",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"denom"},
+	osmosisTotalPoolShares := scrape.NewGaugeVec(
+		"osmosis_total_pool_shares",
+		"",
+		"denom", "display",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(osmosisSwapFee)
-	registry.MustRegister(osmosisExitFee)
-	registry.MustRegister(osmosisPoolWeight)
-	registry.MustRegister(osmosisAssetWeight)
-	registry.MustRegister(osmosisAssetAmount)
-	registry.MustRegister(osmosisTotalPoolShares)
-
 	// Set metric values
 	swapFee, err := strconv.ParseFloat(osmosisPoolRes.Pool.PoolParams.SwapFee, 64)
 	if err != nil {
@@ -151,27 +132,30 @@ func OsmosisHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	osmosisPoolWeight.Set(poolWeight)
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		for _, liquidity := range osmosisTotalLiquidityRes.Liquidity {
 			if strings.Contains(priceDenoms, liquidity.Denom) || priceDenoms == "" {
-				totalShares, err := strconv.ParseFloat(liquidity.Amount, 64)
+				totalShares, err := sdk.NewDecFromStr(liquidity.Amount)
 				if err != nil {
 					sublogger.Error().
 						Err(err).
 						Str("pool_id", poolId).
-						Float64("total_shares", totalShares).
+						Str("total_shares", liquidity.Amount).
 						Msg("Could not set the osmosis total shares")
+					continue
 				}
-				osmosisTotalPoolShares.With(prometheus.Labels{"denom": liquidity.Denom}).Set(totalShares)
+
+				value, denom, display := scrape.Chain.Denoms.Amount(liquidity.Denom, totalShares)
+				osmosisTotalPoolShares.With(prometheus.Labels{
+					"denom":   denom,
+					"display": strconv.FormatBool(display),
+				}).Set(value)
 			}
 		}
-	}()
+		return nil
+	})
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		for _, asset := range osmosisPoolRes.Pool.PoolAssets {
 			assetWeight, err := strconv.ParseFloat(asset.Weight, 64)
 			if err != nil {
@@ -184,28 +168,27 @@ func OsmosisHandler(w http.ResponseWriter, r *http.Request) {
 			}
 			osmosisAssetWeight.With(prometheus.Labels{"denom": asset.Token.Denom}).Set(assetWeight)
 
-			assetAmount, err := strconv.ParseFloat(asset.Token.Amount, 64)
+			assetAmount, err := sdk.NewDecFromStr(asset.Token.Amount)
 			if err != nil {
 				sublogger.Error().
 					Err(err).
 					Str("pool_id", poolId).
 					Str("denom", asset.Token.Denom).
-					Float64("asset_amount", assetAmount).
+					Str("asset_amount", asset.Token.Amount).
 					Msg("Could not set the osmosis asset amount")
+				continue
 			}
-			osmosisAssetWeight.With(prometheus.Labels{"denom": asset.Token.Denom}).Set(assetWeight)
+
+			value, denom, display := scrape.Chain.Denoms.Amount(asset.Token.Denom, assetAmount)
+			osmosisAssetAmount.With(prometheus.Labels{
+				"denom":   denom,
+				"display": strconv.FormatBool(display),
+			}).Set(value)
 		}
-	}()
-
-	wg.Wait()
-	// Serve response
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/osmosis").
-		Float64("request_time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+		return nil
+	})
+
+	return scrape.Wait()
 }
 
 type restClient struct {
@@ -216,19 +199,19 @@ type restClient struct {
 func newRestClient(host string) *restClient {
 	var c restClient
 	c.url = url.URL{Host: host, Scheme: "https"}
-	c.httpClient = &http.Client{}
+	c.httpClient = &http.Client{Timeout: RestTimeout}
 	return &c
 }
 
 // request makes http request with specified path and optional query
-func (client *restClient) request(path string, query string) ([]byte, error) {
+func (client *restClient) request(ctx context.Context, path string, query string) ([]byte, error) {
 	// avoid race condition with concurrent overwrites: work with copy of restClient's url object for each request!
 	ref := client.url
 	ref.Path = path
 	ref.RawQuery = query
 	url := ref.ResolveReference(&ref).String()
 
-	req, err := http.NewRequest("GET", url, nil) // will slow down exit while waiting for timeouts, but using http.NewRequestWithContext would more likely create inconsistencies when interrupted with context.Canceled
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil) // cancelled along with the scrape, so a hung LCD does not hang the scrape
 	if err != nil {
 		return nil, fmt.Errorf("error creating request %s: %v", url, err)
 	}
@@ -250,10 +233,10 @@ func (client *restClient) request(path string, query string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
-func (client *restClient) getPool(id string) (poolResponse, error) {
+func (client *restClient) getPool(ctx context.Context, id string) (poolResponse, error) {
 	pool := poolResponse{}
 
-	res, err := client.request("/osmosis/gamm/v1beta1/pools/"+id, "")
+	res, err := client.request(ctx, "/osmosis/gamm/v1beta1/pools/"+id, "")
 	if err != nil {
 		return pool, err
 	}
@@ -266,10 +249,10 @@ func (client *restClient) getPool(id string) (poolResponse, error) {
 	return pool, nil
 }
 
-func (client *restClient) getTotalLiquidity(id string) (totalLiquidityResponse, error) {
+func (client *restClient) getTotalLiquidity(ctx context.Context, id string) (totalLiquidityResponse, error) {
 	totalLiquidity := totalLiquidityResponse{}
 
-	res, err := client.request("/osmosis/gamm/v1beta1/total_liquidity", "")
+	res, err := client.request(ctx, "/osmosis/gamm/v1beta1/total_liquidity", "")
 
 	if err != nil {
 		return totalLiquidity, err
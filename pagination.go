@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
+)
+
+// PageQuery fetches a single page of a list query and returns the page response of the node.
+type PageQuery func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error)
+
+// Paginate fetches all the pages of a list query, following NextKey until the node returns none,
+// and returns the number of pages it took. It gives up after MaxPages pages,
+// so a node returning the same key forever cannot hang the scrape.
+func Paginate(fetch PageQuery) (int, error) {
+	var nextKey []byte
+
+	for pages := 1; ; pages++ {
+		if pages > MaxPages {
+			return pages - 1, fmt.Errorf("gave up after %d pages", MaxPages)
+		}
+
+		pageResponse, err := fetch(&querytypes.PageRequest{
+			Key:   nextKey,
+			Limit: Limit,
+		})
+		if err != nil {
+			return pages, err
+		}
+
+		if pageResponse == nil || len(pageResponse.NextKey) == 0 {
+			return pages, nil
+		}
+
+		nextKey = pageResponse.NextKey
+	}
+}
+
+// Paginate fetches all the pages of a list query and records the number of pages it took.
+// The query is named after the gRPC method (e.g. "staking/Validators") in the pages metric.
+func (s *Scrape) Paginate(query string, fetch PageQuery) error {
+	pages, err := Paginate(fetch)
+	s.setPages(query, pages)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", query, err)
+	}
+
+	return nil
+}
+
+func (s *Scrape) setPages(query string, pages int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pages[query] = pages
+}
+
+// Pages returns the number of pages every paginated query of the scrape took.
+func (s *Scrape) Pages() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pages := make(map[string]int, len(s.pages))
+	for query, count := range s.pages {
+		pages[query] = count
+	}
+
+	return pages
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
+)
+
+// pagesQuery returns a query serving the next keys in order, then no next key.
+func pagesQuery(nextKeys ...string) (PageQuery, *[]*querytypes.PageRequest) {
+	var requests []*querytypes.PageRequest
+
+	return func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+		requests = append(requests, pageRequest)
+		if len(requests) > len(nextKeys) {
+			return &querytypes.PageResponse{}, nil
+		}
+
+		return &querytypes.PageResponse{NextKey: []byte(nextKeys[len(requests)-1])}, nil
+	}, &requests
+}
+
+func TestPaginate(t *testing.T) {
+	defer func(limit uint64, maxPages int) {
+		Limit, MaxPages = limit, maxPages
+	}(Limit, MaxPages)
+	Limit, MaxPages = 10, 3
+
+	tests := []struct {
+		name     string
+		nextKeys []string
+		pages    int
+		err      bool
+	}{
+		{name: "single page", pages: 1},
+		{name: "several pages", nextKeys: []string{"a", "b"}, pages: 3},
+		{name: "max pages", nextKeys: []string{"a", "b", "c"}, pages: 3, err: true},
+		{name: "same key forever", nextKeys: []string{"a", "a", "a", "a", "a"}, pages: 3, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, requests := pagesQuery(test.nextKeys...)
+
+			pages, err := Paginate(query)
+			if (err != nil) != test.err {
+				t.Fatalf("got error %v, expected error: %t", err, test.err)
+			}
+
+			if pages != test.pages {
+				t.Errorf("got %d pages, expected %d", pages, test.pages)
+			}
+
+			if len(*requests) != test.pages {
+				t.Fatalf("sent %d requests, expected %d", len(*requests), test.pages)
+			}
+
+			for index, request := range *requests {
+				if request.Limit != Limit {
+					t.Errorf("page %d: got limit %d, expected %d", index+1, request.Limit, Limit)
+				}
+
+				var expectedKey string
+				if index > 0 {
+					expectedKey = test.nextKeys[index-1]
+				}
+
+				if string(request.Key) != expectedKey {
+					t.Errorf("page %d: got key %q, expected %q", index+1, request.Key, expectedKey)
+				}
+			}
+		})
+	}
+}
+
+func TestPaginateError(t *testing.T) {
+	defer func(maxPages int) {
+		MaxPages = maxPages
+	}(MaxPages)
+	MaxPages = 10
+
+	queryErr := errors.New("unavailable")
+	calls := 0
+
+	pages, err := Paginate(func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+		calls++
+		if calls == 2 {
+			return nil, queryErr
+		}
+
+		return &querytypes.PageResponse{NextKey: []byte("a")}, nil
+	})
+
+	if !errors.Is(err, queryErr) {
+		t.Fatalf("got error %v, expected %v", err, queryErr)
+	}
+
+	if pages != 2 {
+		t.Errorf("got %d pages, expected 2", pages)
+	}
+}
+
+func TestScrapePaginate(t *testing.T) {
+	defer func(maxPages int) {
+		MaxPages = maxPages
+	}(MaxPages)
+	MaxPages = 2
+
+	scrape := &Scrape{pages: map[string]int{}}
+
+	query, _ := pagesQuery("a")
+	if err := scrape.Paginate("staking/Validators", query); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	query, _ = pagesQuery("a", "b")
+	err := scrape.Paginate("slashing/SigningInfos", query)
+	if err == nil || !strings.HasPrefix(err.Error(), "slashing/SigningInfos: ") {
+		t.Errorf("got error %v, expected it to be prefixed by the query", err)
+	}
+
+	expected := map[string]int{"staking/Validators": 2, "slashing/SigningInfos": 2}
+	pages := scrape.Pages()
+	for query, count := range expected {
+		if pages[query] != count {
+			t.Errorf("%s: got %d pages, expected %d", query, pages[query], count)
+		}
+	}
+}
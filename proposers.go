@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ValidatorProposals is what a validator proposed since the exporter started following the blocks.
+type ValidatorProposals struct {
+	// Address is the hex address of the consensus key of the validator, as in Tendermint RPC.
+	Address string
+
+	Proposed uint64
+	// Expected is the sum of the share of the voting power of the validator over the blocks,
+	// the number of blocks it would have proposed if the proposers were picked by voting power.
+	Expected           float64
+	LastProposedHeight int64
+}
+
+// ProposerTracker keeps the blocks every validator proposed and was expected to propose.
+type ProposerTracker struct {
+	mutex      sync.Mutex
+	height     int64
+	validators map[string]*ValidatorProposals
+}
+
+func NewProposerTracker() *ProposerTracker {
+	return &ProposerTracker{validators: make(map[string]*ValidatorProposals)}
+}
+
+func (t *ProposerTracker) validator(address string) *ValidatorProposals {
+	validator, ok := t.validators[address]
+	if !ok {
+		validator = &ValidatorProposals{Address: address}
+		t.validators[address] = validator
+	}
+
+	return validator
+}
+
+// HandleBlock records the proposer of the block. The proposals are expected from the validator set
+// of the previous block, the set of the block itself only differs from it when the set changes.
+func (t *ProposerTracker) HandleBlock(block *Block) {
+	if block.LastCommit == nil {
+		return
+	}
+
+	var totalVotingPower int64
+	for _, blockValidator := range block.LastCommit.Validators {
+		totalVotingPower += blockValidator.VotingPower
+	}
+
+	if totalVotingPower == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.height = block.Height
+
+	for _, blockValidator := range block.LastCommit.Validators {
+		t.validator(blockValidator.Address).Expected += float64(blockValidator.VotingPower) / float64(totalVotingPower)
+	}
+
+	proposer := t.validator(block.ProposerAddress)
+	proposer.Proposed++
+	proposer.LastProposedHeight = block.Height
+}
+
+// Snapshot returns the height of the last block recorded and what every validator proposed.
+func (t *ProposerTracker) Snapshot() (int64, []ValidatorProposals) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	validators := make([]ValidatorProposals, 0, len(t.validators))
+	for _, validator := range t.validators {
+		validators = append(validators, *validator)
+	}
+
+	return t.height, validators
+}
+
+type ProposersCollector struct{}
+
+func NewProposersCollector() *ProposersCollector {
+	return &ProposersCollector{}
+}
+
+func (c *ProposersCollector) Name() string {
+	return "proposers"
+}
+
+func (c *ProposersCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *ProposersCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	proposerHeightGauge := scrape.NewGauge(
+		"cosmos_proposer_tracker_height",
+		"Height of the last block the proposer was recorded for",
+	)
+
+	proposedBlocksCounter := scrape.NewCounterVec(
+		"cosmos_validator_proposed_blocks_total",
+		"Blocks proposed by the Cosmos-based blockchain validator since the exporter started",
+		"address", "moniker", "cons_address",
+	)
+
+	expectedProposedBlocksCounter := scrape.NewCounterVec(
+		"cosmos_validator_expected_proposed_blocks_total",
+		"Blocks the Cosmos-based blockchain validator was expected to propose since the exporter started, from its share of the voting power",
+		"address", "moniker", "cons_address",
+	)
+
+	proposalRatioGauge := scrape.NewGaugeVec(
+		"cosmos_validator_proposal_ratio",
+		"Blocks proposed by the Cosmos-based blockchain validator over the blocks it was expected to propose",
+		"address", "moniker", "cons_address",
+	)
+
+	lastProposedHeightGauge := scrape.NewGaugeVec(
+		"cosmos_validator_last_proposed_block_height",
+		"Height of the last block proposed by the Cosmos-based blockchain validator",
+		"address", "moniker", "cons_address",
+	)
+
+	height, proposals := scrape.Chain.Proposers().Snapshot()
+	proposerHeightGauge.Set(float64(height))
+
+	if len(proposals) == 0 {
+		sublogger.Debug().Msg("No block followed yet")
+		return nil
+	}
+
+	validatorsByConsAddress, err := FetchValidatorsByConsAddress(ctx, scrape)
+
+	for _, proposal := range proposals {
+		labels := ValidatorLabels(validatorsByConsAddress, proposal.Address)
+
+		proposedBlocksCounter.With(labels).Add(float64(proposal.Proposed))
+		expectedProposedBlocksCounter.With(labels).Add(proposal.Expected)
+
+		if proposal.Expected > 0 {
+			proposalRatioGauge.With(labels).Set(float64(proposal.Proposed) / proposal.Expected)
+		}
+
+		if proposal.LastProposedHeight > 0 {
+			lastProposedHeightGauge.With(labels).Set(float64(proposal.LastProposedHeight))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+)
+
+// targets having query params (e.g. a wallet address) that were not scraped for this
+// many refresh intervals are not refreshed anymore
+const idleTargetIntervals = 10
+
+// Scheduler refreshes the collectors in the background and serves the latest snapshot
+// from memory, so scraping the exporter does not hit the node every time.
+type Scheduler struct {
+	chains          *Chains
+	defaultInterval time.Duration
+	intervals       map[string]time.Duration
+	metrics         *ExporterMetrics
+
+	mutex   sync.Mutex
+	targets map[string]*scheduledTarget
+}
+
+// scheduledTarget is a collector of a chain with a specific set of query params.
+type scheduledTarget struct {
+	chain     *Chain
+	collector Collector
+	params    url.Values
+	interval  time.Duration
+	metrics   *ExporterMetrics
+
+	ready chan struct{}
+
+	mutex         sync.RWMutex
+	snapshot      *prometheus.Registry
+	lastRequested time.Time
+
+	lastSuccessGauge prometheus.Gauge
+	registry         *prometheus.Registry
+}
+
+func NewScheduler(chains *Chains, defaultInterval time.Duration, intervals map[string]time.Duration, metrics *ExporterMetrics) *Scheduler {
+	return &Scheduler{
+		chains:          chains,
+		defaultInterval: defaultInterval,
+		intervals:       intervals,
+		metrics:         metrics,
+		targets:         map[string]*scheduledTarget{},
+	}
+}
+
+func (s *Scheduler) interval(name string) time.Duration {
+	if interval, ok := s.intervals[name]; ok {
+		return interval
+	}
+
+	return s.defaultInterval
+}
+
+// Handler returns an HTTP handler serving the metrics of a collector.
+// If the refresh interval of the collector is 0, the node is queried on every request.
+func (s *Scheduler) Handler(collector Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+
+		params := r.URL.Query()
+
+		chain, err := s.chains.Get(params.Get("chain"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.Del("chain")
+
+		sublogger := log.With().
+			Str("request-id", uuid.New().String()).
+			Str("chain", chain.Name).
+			Logger()
+
+		for _, param := range collector.RequiredParams() {
+			if params.Get(param) == "" {
+				http.Error(w, "Missing query param: "+param, http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := ScrapeContext(r)
+		defer cancel()
+
+		var target *scheduledTarget
+		if interval := s.interval(collector.Name()); interval == 0 {
+			target = newScheduledTarget(chain, collector, params, interval, s.metrics)
+			target.refresh(ctx, &sublogger)
+			close(target.ready)
+		} else {
+			target = s.target(ctx, chain, collector, params, interval, &sublogger)
+		}
+
+		snapshot := target.Snapshot()
+		if snapshot == nil {
+			http.Error(w, "Invalid query params", http.StatusBadRequest)
+			return
+		}
+
+		h := promhttp.HandlerFor(prometheus.Gatherers{snapshot, target.registry}, promhttp.HandlerOpts{})
+		h.ServeHTTP(w, r)
+		sublogger.Info().
+			Str("method", "GET").
+			Str("endpoint", r.URL.RequestURI()).
+			Float64("request-time", time.Since(requestStart).Seconds()).
+			Msg("Request processed")
+	}
+}
+
+// target returns the scheduled target for these params, creating it and starting
+// its refresh loop if it was not scraped before. The first refresh is done within the scrape context.
+func (s *Scheduler) target(
+	ctx context.Context,
+	chain *Chain,
+	collector Collector,
+	params url.Values,
+	interval time.Duration,
+	sublogger *zerolog.Logger,
+) *scheduledTarget {
+	key := chain.Name + "/" + collector.Name() + "?" + params.Encode()
+
+	s.mutex.Lock()
+	target, ok := s.targets[key]
+	if !ok {
+		target = newScheduledTarget(chain, collector, params, interval, s.metrics)
+		s.targets[key] = target
+	}
+	s.mutex.Unlock()
+
+	if ok {
+		<-target.ready
+		target.touch()
+		return target
+	}
+
+	target.touch()
+	target.refresh(ctx, sublogger)
+	close(target.ready)
+
+	if target.Snapshot() == nil {
+		// invalid params, there's no point in refreshing it
+		s.remove(key)
+		return target
+	}
+
+	go s.run(key, target)
+	return target
+}
+
+func (s *Scheduler) remove(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.targets, key)
+}
+
+func (s *Scheduler) run(key string, target *scheduledTarget) {
+	ticker := time.NewTicker(target.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if len(target.params) > 0 && target.idleFor() > target.interval*idleTargetIntervals {
+			log.Debug().
+				Str("target", key).
+				Msg("Target was not scraped recently, stopping refreshing it")
+			s.remove(key)
+			return
+		}
+
+		sublogger := log.With().
+			Str("request-id", uuid.New().String()).
+			Str("target", key).
+			Logger()
+
+		// a refresh taking longer than the interval would only delay the next one
+		ctx, cancel := context.WithTimeout(context.Background(), target.interval)
+		target.refresh(ctx, &sublogger)
+		cancel()
+	}
+}
+
+func newScheduledTarget(
+	chain *Chain,
+	collector Collector,
+	params url.Values,
+	interval time.Duration,
+	metrics *ExporterMetrics,
+) *scheduledTarget {
+	// labelled like the other self-metrics, so the targets can be aggregated per chain and collector
+	constLabels := prometheus.Labels{
+		"chain":     chain.Name,
+		"collector": collector.Name(),
+	}
+	for name, value := range chain.ConstLabels {
+		constLabels[name] = value
+	}
+
+	lastSuccessGauge := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "cosmos_exporter_last_successful_refresh_timestamp",
+			Help:        "Unix timestamp of the last refresh of the collector during which all queries succeeded",
+			ConstLabels: constLabels,
+		},
+	)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(lastSuccessGauge)
+
+	return &scheduledTarget{
+		chain:            chain,
+		collector:        collector,
+		params:           params,
+		interval:         interval,
+		metrics:          metrics,
+		ready:            make(chan struct{}),
+		lastSuccessGauge: lastSuccessGauge,
+		registry:         registry,
+	}
+}
+
+// refresh collects the metrics and replaces the snapshot. A partially filled registry
+// only replaces the snapshot if there is no previous one, otherwise the last good snapshot is kept.
+func (t *scheduledTarget) refresh(ctx context.Context, sublogger *zerolog.Logger) {
+	refreshStart := time.Now()
+
+	scrape := NewScrape(t.chain, t.params, sublogger)
+	err := t.collector.Collect(ctx, scrape)
+	// in case the collector returned before all of its queries finished
+	if waitErr := scrape.Wait(); err == nil {
+		err = waitErr
+	}
+
+	var invalidParamError *InvalidParamError
+	if errors.As(err, &invalidParamError) {
+		sublogger.Error().
+			Str("collector", t.collector.Name()).
+			Err(err).
+			Msg("Invalid query params")
+		return
+	}
+
+	t.metrics.ObserveCollection(t.chain.Name, t.collector.Name(), time.Since(refreshStart), err, scrape.Timeouts())
+	t.metrics.ObserveCollectorUpstream(t.chain.Name, t.collector.Name(), scrape.Upstream.Name())
+	t.metrics.ObserveQueryPages(t.chain.Name, t.collector.Name(), scrape.Pages())
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err != nil {
+		sublogger.Error().
+			Str("collector", t.collector.Name()).
+			Str("upstream", scrape.Upstream.Name()).
+			Err(err).
+			Msg("Could not refresh collector")
+
+		if t.snapshot == nil {
+			t.snapshot = scrape.Registry
+		}
+		return
+	}
+
+	t.snapshot = scrape.Registry
+	t.lastSuccessGauge.Set(float64(time.Now().Unix()))
+
+	sublogger.Debug().
+		Str("collector", t.collector.Name()).
+		Float64("request-time", time.Since(refreshStart).Seconds()).
+		Msg("Refreshed collector")
+}
+
+func (t *scheduledTarget) Snapshot() *prometheus.Registry {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.snapshot
+}
+
+func (t *scheduledTarget) touch() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lastRequested = time.Now()
+}
+
+func (t *scheduledTarget) idleFor() time.Duration {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return time.Since(t.lastRequested)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/simapp"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// ValidatorSigning is what a validator signed since the exporter started following the blocks.
+type ValidatorSigning struct {
+	// Address is the hex address of the consensus key of the validator, as in Tendermint RPC.
+	Address string
+
+	Signed uint64
+	Missed uint64
+	// RecentSigned is the number of blocks signed among the RecentBlocks last blocks of the window
+	// the validator was in the validator set for.
+	RecentSigned      int
+	RecentBlocks      int
+	ConsecutiveMissed int64
+}
+
+type validatorSigning struct {
+	ValidatorSigning
+
+	// the votes on the last blocks of the window, as a ring buffer
+	recent     []bool
+	next       int
+	lastHeight int64
+}
+
+// SigningTracker keeps what every validator signed over a sliding window of blocks.
+type SigningTracker struct {
+	window int
+
+	mutex      sync.Mutex
+	height     int64
+	validators map[string]*validatorSigning
+}
+
+func NewSigningTracker(window int) *SigningTracker {
+	return &SigningTracker{
+		window:     window,
+		validators: make(map[string]*validatorSigning),
+	}
+}
+
+// HandleBlock records the votes of the validators on the previous block, from the commit the block includes.
+func (t *SigningTracker) HandleBlock(block *Block) {
+	commit := block.LastCommit
+	if commit == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.height = commit.Height
+
+	for _, blockValidator := range commit.Validators {
+		validator, ok := t.validators[blockValidator.Address]
+		if !ok {
+			validator = &validatorSigning{
+				ValidatorSigning: ValidatorSigning{Address: blockValidator.Address},
+				recent:           make([]bool, t.window),
+			}
+			t.validators[blockValidator.Address] = validator
+		}
+
+		if blockValidator.Signed {
+			validator.Signed++
+			validator.ConsecutiveMissed = 0
+		} else {
+			validator.Missed++
+			validator.ConsecutiveMissed++
+		}
+
+		if validator.RecentBlocks == t.window {
+			// the oldest vote is dropped from the window
+			if validator.recent[validator.next] {
+				validator.RecentSigned--
+			}
+		} else {
+			validator.RecentBlocks++
+		}
+
+		validator.recent[validator.next] = blockValidator.Signed
+		if blockValidator.Signed {
+			validator.RecentSigned++
+		}
+
+		validator.next = (validator.next + 1) % t.window
+		validator.lastHeight = commit.Height
+	}
+
+	// the validators out of the set for a whole window are forgotten
+	for address, validator := range t.validators {
+		if commit.Height-validator.lastHeight > int64(t.window) {
+			delete(t.validators, address)
+		}
+	}
+}
+
+// Snapshot returns the height of the last block recorded and what every validator signed.
+func (t *SigningTracker) Snapshot() (int64, []ValidatorSigning) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	validators := make([]ValidatorSigning, 0, len(t.validators))
+	for _, validator := range t.validators {
+		validators = append(validators, validator.ValidatorSigning)
+	}
+
+	return t.height, validators
+}
+
+type SigningCollector struct{}
+
+func NewSigningCollector() *SigningCollector {
+	return &SigningCollector{}
+}
+
+func (c *SigningCollector) Name() string {
+	return "signing"
+}
+
+func (c *SigningCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *SigningCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	signingHeightGauge := scrape.NewGauge(
+		"cosmos_signing_tracker_height",
+		"Height of the last block the signatures were recorded for",
+	)
+
+	signingWindowGauge := scrape.NewGauge(
+		"cosmos_signing_tracker_window",
+		"Number of blocks of the sliding window the uptime is computed over",
+	)
+
+	signedBlocksCounter := scrape.NewCounterVec(
+		"cosmos_validators_signed_blocks_total",
+		"Blocks signed by the Cosmos-based blockchain validator since the exporter started",
+		"address", "moniker", "cons_address",
+	)
+
+	missedBlocksCounter := scrape.NewCounterVec(
+		"cosmos_validators_missed_blocks_total",
+		"Blocks missed by the Cosmos-based blockchain validator since the exporter started",
+		"address", "moniker", "cons_address",
+	)
+
+	uptimeGauge := scrape.NewGaugeVec(
+		"cosmos_validators_uptime",
+		"Fraction of the blocks of the sliding window signed by the Cosmos-based blockchain validator",
+		"address", "moniker", "cons_address",
+	)
+
+	uptimeBlocksGauge := scrape.NewGaugeVec(
+		"cosmos_validators_uptime_blocks",
+		"Number of blocks of the sliding window the Cosmos-based blockchain validator was in the validator set for",
+		"address", "moniker", "cons_address",
+	)
+
+	consecutiveMissedGauge := scrape.NewGaugeVec(
+		"cosmos_validators_consecutive_missed_blocks",
+		"Number of blocks the Cosmos-based blockchain validator missed in a row",
+		"address", "moniker", "cons_address",
+	)
+
+	height, signings := scrape.Chain.Signing().Snapshot()
+	signingHeightGauge.Set(float64(height))
+	signingWindowGauge.Set(float64(SigningWindow))
+
+	if len(signings) == 0 {
+		sublogger.Debug().Msg("No block followed yet")
+		return nil
+	}
+
+	validatorsByConsAddress, err := FetchValidatorsByConsAddress(ctx, scrape)
+
+	for _, signing := range signings {
+		labels := ValidatorLabels(validatorsByConsAddress, signing.Address)
+
+		signedBlocksCounter.With(labels).Add(float64(signing.Signed))
+		missedBlocksCounter.With(labels).Add(float64(signing.Missed))
+		uptimeBlocksGauge.With(labels).Set(float64(signing.RecentBlocks))
+		consecutiveMissedGauge.With(labels).Set(float64(signing.ConsecutiveMissed))
+
+		if signing.RecentBlocks > 0 {
+			uptimeGauge.With(labels).Set(float64(signing.RecentSigned) / float64(signing.RecentBlocks))
+		}
+	}
+
+	return err
+}
+
+// ValidatorLabels returns the labels of the validator with the hex consensus address, as in the Tendermint blocks.
+// The address and moniker are empty if the validator is not among the validators fetched.
+func ValidatorLabels(validatorsByConsAddress map[string]stakingtypes.Validator, consAddress string) prometheus.Labels {
+	labels := prometheus.Labels{"address": "", "moniker": "", "cons_address": consAddress}
+	if validator, ok := validatorsByConsAddress[consAddress]; ok {
+		labels["address"] = validator.OperatorAddress
+		labels["moniker"] = validator.Description.Moniker
+	}
+
+	return labels
+}
+
+// FetchValidatorsByConsAddress returns all the validators by the hex address of their consensus key,
+// as in the Tendermint blocks. The validators which could not be fetched are left out, with an error.
+func FetchValidatorsByConsAddress(ctx context.Context, scrape *Scrape) (map[string]stakingtypes.Validator, error) {
+	validators, err := FetchValidators(ctx, scrape)
+	return ValidatorsByConsAddress(scrape.Logger, validators), err
+}
+
+// FetchValidators returns all the staking validators. The pages fetched before an error are returned with it.
+func FetchValidators(ctx context.Context, scrape *Scrape) ([]stakingtypes.Validator, error) {
+	sublogger := scrape.Logger
+
+	sublogger.Debug().Msg("Started querying validators")
+	queryStart := time.Now()
+
+	var validators []stakingtypes.Validator
+
+	stakingClient := stakingtypes.NewQueryClient(scrape.Upstream.GrpcConn)
+	err := scrape.Paginate("staking/Validators", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+		validatorsResponse, err := stakingClient.Validators(
+			ctx,
+			&stakingtypes.QueryValidatorsRequest{Pagination: pageRequest},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		validators = append(validators, validatorsResponse.Validators...)
+		return validatorsResponse.Pagination, nil
+	})
+	if err != nil {
+		sublogger.Error().Err(err).Msg("Could not get validators")
+		return validators, err
+	}
+
+	sublogger.Debug().
+		Float64("request-time", time.Since(queryStart).Seconds()).
+		Msg("Finished querying validators")
+
+	return validators, nil
+}
+
+// ValidatorsByConsAddress indexes the validators by the hex address of their consensus key.
+// The validators whose consensus key cannot be decoded are left out.
+func ValidatorsByConsAddress(sublogger *zerolog.Logger, validators []stakingtypes.Validator) map[string]stakingtypes.Validator {
+	interfaceRegistry := simapp.MakeTestEncodingConfig().InterfaceRegistry
+
+	validatorsByConsAddress := make(map[string]stakingtypes.Validator, len(validators))
+	for _, validator := range validators {
+		if err := validator.UnpackInterfaces(interfaceRegistry); err != nil {
+			sublogger.Error().
+				Str("address", validator.OperatorAddress).
+				Err(err).
+				Msg("Could not unpack validator interfaces")
+			continue
+		}
+
+		consAddress, err := validator.GetConsAddr()
+		if err != nil {
+			sublogger.Error().
+				Str("address", validator.OperatorAddress).
+				Err(err).
+				Msg("Could not get validator pubkey")
+			continue
+		}
+
+		validatorsByConsAddress[strings.ToUpper(hex.EncodeToString(consAddress))] = validator
+	}
+
+	return validatorsByConsAddress
+}
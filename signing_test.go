@@ -0,0 +1,172 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// commitBlock returns the block including the commit of the height, signed by the validators given.
+func commitBlock(height int64, votes map[string]bool) *Block {
+	commit := &Commit{Height: height}
+	for address, signed := range votes {
+		commit.Validators = append(commit.Validators, BlockValidator{Address: address, VotingPower: 10, Signed: signed})
+	}
+
+	return &Block{Height: height + 1, LastCommit: commit}
+}
+
+func trackedValidator(t *testing.T, tracker *SigningTracker, address string) (ValidatorSigning, bool) {
+	t.Helper()
+
+	_, validators := tracker.Snapshot()
+	for _, validator := range validators {
+		if validator.Address == address {
+			return validator, true
+		}
+	}
+
+	return ValidatorSigning{}, false
+}
+
+func TestSigningTrackerWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   int
+		votes    []bool
+		expected ValidatorSigning
+	}{
+		{
+			name:     "window not full",
+			window:   5,
+			votes:    []bool{true, false, true},
+			expected: ValidatorSigning{Signed: 2, Missed: 1, RecentSigned: 2, RecentBlocks: 3},
+		},
+		{
+			name:     "window full",
+			window:   3,
+			votes:    []bool{true, true, true},
+			expected: ValidatorSigning{Signed: 3, RecentSigned: 3, RecentBlocks: 3},
+		},
+		{
+			name:     "oldest signed vote dropped",
+			window:   3,
+			votes:    []bool{true, false, false, false},
+			expected: ValidatorSigning{Signed: 1, Missed: 3, RecentSigned: 0, RecentBlocks: 3, ConsecutiveMissed: 3},
+		},
+		{
+			name:     "oldest missed vote dropped",
+			window:   3,
+			votes:    []bool{false, true, true, true},
+			expected: ValidatorSigning{Signed: 3, Missed: 1, RecentSigned: 3, RecentBlocks: 3},
+		},
+		{
+			name:     "ring wrapped several times",
+			window:   3,
+			votes:    []bool{true, false, true, true, false, true, false, false},
+			expected: ValidatorSigning{Signed: 4, Missed: 4, RecentSigned: 1, RecentBlocks: 3, ConsecutiveMissed: 2},
+		},
+		{
+			name:     "window of one block",
+			window:   1,
+			votes:    []bool{false, true, false},
+			expected: ValidatorSigning{Signed: 1, Missed: 2, RecentSigned: 0, RecentBlocks: 1, ConsecutiveMissed: 1},
+		},
+		{
+			name:     "consecutive missed reset",
+			window:   10,
+			votes:    []bool{false, false, true, false},
+			expected: ValidatorSigning{Signed: 1, Missed: 3, RecentSigned: 1, RecentBlocks: 4, ConsecutiveMissed: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := NewSigningTracker(test.window)
+			for index, signed := range test.votes {
+				tracker.HandleBlock(commitBlock(int64(index+1), map[string]bool{"A": signed}))
+			}
+
+			test.expected.Address = "A"
+			validator, ok := trackedValidator(t, tracker, "A")
+			if !ok {
+				t.Fatal("validator not tracked")
+			}
+
+			if validator != test.expected {
+				t.Errorf("got %+v, expected %+v", validator, test.expected)
+			}
+		})
+	}
+}
+
+func TestSigningTrackerHeight(t *testing.T) {
+	tracker := NewSigningTracker(3)
+
+	// the first block of the chain has no commit
+	tracker.HandleBlock(&Block{Height: 1})
+	if height, validators := tracker.Snapshot(); height != 0 || len(validators) != 0 {
+		t.Fatalf("got height %d and %d validators for a block without commit", height, len(validators))
+	}
+
+	tracker.HandleBlock(commitBlock(1, map[string]bool{"A": true}))
+	if height, _ := tracker.Snapshot(); height != 1 {
+		t.Errorf("got height %d, expected 1", height)
+	}
+}
+
+func TestSigningTrackerForgetsValidators(t *testing.T) {
+	tracker := NewSigningTracker(3)
+
+	tracker.HandleBlock(commitBlock(1, map[string]bool{"A": true, "B": true}))
+
+	// B left the set, it is kept for a whole window
+	for height := int64(2); height <= 4; height++ {
+		tracker.HandleBlock(commitBlock(height, map[string]bool{"A": true}))
+	}
+
+	validator, ok := trackedValidator(t, tracker, "B")
+	if !ok {
+		t.Fatal("validator forgotten before the end of the window")
+	}
+
+	if validator.Signed != 1 || validator.RecentBlocks != 1 {
+		t.Errorf("got %+v for the validator out of the set, expected its votes unchanged", validator)
+	}
+
+	tracker.HandleBlock(commitBlock(5, map[string]bool{"A": true}))
+	if _, ok := trackedValidator(t, tracker, "B"); ok {
+		t.Error("validator out of the set for a whole window not forgotten")
+	}
+
+	if _, ok := trackedValidator(t, tracker, "A"); !ok {
+		t.Error("validator in the set forgotten")
+	}
+}
+
+func TestValidatorLabels(t *testing.T) {
+	validatorsByConsAddress := map[string]stakingtypes.Validator{
+		"0A1B": {OperatorAddress: "cosmosvaloper1a", Description: stakingtypes.Description{Moniker: "A"}},
+	}
+
+	tests := []struct {
+		consAddress string
+		expected    prometheus.Labels
+	}{
+		{consAddress: "0A1B", expected: prometheus.Labels{"address": "cosmosvaloper1a", "moniker": "A", "cons_address": "0A1B"}},
+		{consAddress: "2C3D", expected: prometheus.Labels{"address": "", "moniker": "", "cons_address": "2C3D"}},
+	}
+
+	for _, test := range tests {
+		if labels := ValidatorLabels(validatorsByConsAddress, test.consAddress); !reflect.DeepEqual(labels, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.consAddress, labels, test.expected)
+		}
+	}
+
+	// the failed lookup of the validators keeps the same consensus address
+	if labels := ValidatorLabels(nil, "0A1B"); labels["cons_address"] != "0A1B" || labels["address"] != "" {
+		t.Errorf("got %v without the validators", labels)
+	}
+}
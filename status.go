@@ -1,20 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
-	"regexp"
 	"strconv"
-	"strings"
-	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
-	"google.golang.org/grpc"
 )
 
 type StatusResponse struct {
@@ -85,83 +79,228 @@ type ConsensusStateResponse struct {
 	} `json:"result"`
 }
 
-func StatusHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
-	requestStart := time.Now()
+type NetInfoResponse struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		Listening bool   `json:"listening"`
+		NPeers    string `json:"n_peers"`
+		Peers     []struct {
+			NodeInfo struct {
+				ID      string `json:"id"`
+				Moniker string `json:"moniker"`
+				Network string `json:"network"`
+				Version string `json:"version"`
+			} `json:"node_info"`
+			IsOutbound       bool `json:"is_outbound"`
+			ConnectionStatus struct {
+				SendMonitor struct {
+					Bytes   int64 `json:"Bytes,string"`
+					CurRate int64 `json:"CurRate,string"`
+				} `json:"SendMonitor"`
+				RecvMonitor struct {
+					Bytes   int64 `json:"Bytes,string"`
+					CurRate int64 `json:"CurRate,string"`
+				} `json:"RecvMonitor"`
+			} `json:"connection_status"`
+			RemoteIP string `json:"remote_ip"`
+		} `json:"peers"`
+	} `json:"result"`
+}
+
+type StatusCollector struct{}
+
+func NewStatusCollector() *StatusCollector {
+	return &StatusCollector{}
+}
+
+func (c *StatusCollector) Name() string {
+	return "status"
+}
 
-	sublogger := log.With().
-		Str("request_id", uuid.New().String()).
-		Logger()
+func (c *StatusCollector) RequiredParams() []string {
+	return nil
+}
 
-	blockAgeGauge := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "block_age",
-			Help:        "Age of the latest block in seconds",
-			ConstLabels: ConstLabels,
-		},
+func (c *StatusCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	blockAgeGauge := scrape.NewGauge(
+		"block_age",
+		"Age of the latest block in seconds",
 	)
 
-	missingValidatorsGauge := prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name:        "missing_validators",
-			Help:        "Number of missing validators for the latest block",
-			ConstLabels: ConstLabels,
-		},
+	missingValidatorsGauge := scrape.NewGauge(
+		"missing_validators",
+		"Number of missing validators for the latest block",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(blockAgeGauge)
-	registry.MustRegister(missingValidatorsGauge)
+	catchingUpGauge := scrape.NewGauge(
+		"cosmos_node_catching_up",
+		"Whether the node is catching up with the chain, 1 if it is, 0 if it is synced",
+	)
+
+	latestBlockHeightGauge := scrape.NewGauge(
+		"cosmos_node_latest_block_height",
+		"Height of the latest block of the node",
+	)
+
+	earliestBlockHeightGauge := scrape.NewGauge(
+		"cosmos_node_earliest_block_height",
+		"Height of the earliest block the node has, above 1 if it is pruned or was state synced",
+	)
+
+	nodeInfoGauge := scrape.NewGaugeVec(
+		"cosmos_node_info",
+		"Version and moniker of the node, always 1",
+		"version", "moniker", "node_id",
+	)
+
+	peersGauge := scrape.NewGaugeVec(
+		"cosmos_node_peers",
+		"Number of peers of the node",
+		"direction",
+	)
+
+	peerSendRateGauge := scrape.NewGaugeVec(
+		"cosmos_node_peer_send_rate_bytes",
+		"Rate the node sends data to the peer at, in bytes per second",
+		"peer_id", "moniker",
+	)
+
+	peerReceiveRateGauge := scrape.NewGaugeVec(
+		"cosmos_node_peer_receive_rate_bytes",
+		"Rate the node receives data from the peer at, in bytes per second",
+		"peer_id", "moniker",
+	)
+
+	referenceLagGauge := scrape.NewGauge(
+		"cosmos_node_reference_lag_blocks",
+		"Number of blocks the node is behind the reference node",
+	)
+
+	var latestHeight, referenceHeight int64
+
+	scrape.Go(func() error {
+		statusResponse, err := fetchStatus(ctx, scrape.Chain.HTTPClient, scrape.Upstream.TendermintRPC, sublogger)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Failed to get the status")
+			return err
+		}
+
+		syncInfo := statusResponse.Result.SyncInfo
+		blockAgeGauge.Set(time.Since(syncInfo.LatestBlockTime).Seconds())
+
+		if syncInfo.CatchingUp {
+			catchingUpGauge.Set(1)
+		} else {
+			catchingUpGauge.Set(0)
+		}
 
-	// Set the metric values
-	wg := sync.WaitGroup{}
+		latestHeight, err = strconv.ParseInt(syncInfo.LatestBlockHeight, 10, 64)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not parse the latest block height")
+			return err
+		}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := setBlockAge(&blockAgeGauge, &sublogger)
+		earliestHeight, err := strconv.ParseInt(syncInfo.EarliestBlockHeight, 10, 64)
 		if err != nil {
-			sublogger.Error().Err(err).Msg("Failed to set block age")
+			sublogger.Error().Err(err).Msg("Could not parse the earliest block height")
+			return err
 		}
-	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := setMissingValidators(&missingValidatorsGauge, &sublogger)
+		latestBlockHeightGauge.Set(float64(latestHeight))
+		earliestBlockHeightGauge.Set(float64(earliestHeight))
+
+		nodeInfoGauge.With(prometheus.Labels{
+			"version": statusResponse.Result.NodeInfo.Version,
+			"moniker": statusResponse.Result.NodeInfo.Moniker,
+			"node_id": statusResponse.Result.NodeInfo.ID,
+		}).Set(1)
+		return nil
+	})
+
+	scrape.Go(func() error {
+		err := setMissingValidators(ctx, scrape.Chain.HTTPClient, scrape.Upstream.TendermintRPC, &missingValidatorsGauge, sublogger)
 		if err != nil {
 			sublogger.Error().Err(err).Msg("Failed to set missing validators")
 		}
-	}()
+		return err
+	})
+
+	scrape.Go(func() error {
+		sublogger.Debug().Msg("Started querying net info")
+		queryStart := time.Now()
+
+		body, err := HTTPGet(ctx, scrape.Chain.HTTPClient, scrape.Upstream.TendermintRPC+"/net_info")
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Error getting the net_info")
+			return err
+		}
+
+		netInfoResponse := NetInfoResponse{}
+		if err := json.Unmarshal(body, &netInfoResponse); err != nil {
+			sublogger.Error().Err(err).Msg("Error unmarshalling the net_info json response")
+			return err
+		}
+
+		sublogger.Debug().
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying net info")
+
+		var inbound, outbound int
+		for _, peer := range netInfoResponse.Result.Peers {
+			if peer.IsOutbound {
+				outbound++
+			} else {
+				inbound++
+			}
+
+			labels := prometheus.Labels{"peer_id": peer.NodeInfo.ID, "moniker": peer.NodeInfo.Moniker}
+			peerSendRateGauge.With(labels).Set(float64(peer.ConnectionStatus.SendMonitor.CurRate))
+			peerReceiveRateGauge.With(labels).Set(float64(peer.ConnectionStatus.RecvMonitor.CurRate))
+		}
 
-	wg.Wait()
+		peersGauge.With(prometheus.Labels{"direction": "inbound"}).Set(float64(inbound))
+		peersGauge.With(prometheus.Labels{"direction": "outbound"}).Set(float64(outbound))
+		return nil
+	})
+
+	if scrape.Chain.ReferenceRPC != "" {
+		scrape.Go(func() error {
+			statusResponse, err := fetchStatus(ctx, scrape.Chain.HTTPClient, scrape.Chain.ReferenceRPC, sublogger)
+			if err != nil {
+				sublogger.Error().Err(err).Msg("Failed to get the status of the reference node")
+				return err
+			}
+
+			referenceHeight, err = strconv.ParseInt(statusResponse.Result.SyncInfo.LatestBlockHeight, 10, 64)
+			if err != nil {
+				sublogger.Error().Err(err).Msg("Could not parse the latest block height of the reference node")
+				return err
+			}
+
+			return nil
+		})
+	}
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/status").
-		Float64("request_time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+	_ = scrape.Wait()
+
+	if latestHeight > 0 && referenceHeight > 0 {
+		referenceLagGauge.Set(float64(referenceHeight - latestHeight))
+	}
+
+	return scrape.Wait()
 }
 
-func setBlockAge(gaugePtr *prometheus.Gauge, sublogger *zerolog.Logger) error {
+func fetchStatus(ctx context.Context, httpClient *http.Client, tendermintRPC string, sublogger *zerolog.Logger) (*StatusResponse, error) {
 	// /status endpoint
-	resp, err := http.Get(TendermintRPC + "/status")
+	body, err := HTTPGet(ctx, httpClient, tendermintRPC+"/status")
 	if err != nil {
 		sublogger.Error().
 			Err(err).
 			Msg("Error getting the status")
-	}
-
-	if resp.Body != nil {
-		defer resp.Body.Close()
-	}
-
-	body, readErr := ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		sublogger.Error().
-			Err(readErr).
-			Msg("Error reading the status")
+		return nil, err
 	}
 
 	statusResponse := StatusResponse{}
@@ -170,30 +309,19 @@ func setBlockAge(gaugePtr *prometheus.Gauge, sublogger *zerolog.Logger) error {
 		sublogger.Error().
 			Err(err).
 			Msg("Error unmarshalling the status json response")
+		return nil, err
 	}
-	gauge := *gaugePtr
 
-	gauge.Set(time.Since(statusResponse.Result.SyncInfo.LatestBlockTime).Seconds())
-	return nil
+	return &statusResponse, nil
 }
 
-func setMissingValidators(gaugePtr *prometheus.Gauge, sublogger *zerolog.Logger) error {
-	resp, err := http.Get(TendermintRPC + "/consensus_state")
+func setMissingValidators(ctx context.Context, httpClient *http.Client, tendermintRPC string, gaugePtr *prometheus.Gauge, sublogger *zerolog.Logger) error {
+	body, err := HTTPGet(ctx, httpClient, tendermintRPC+"/consensus_state")
 	if err != nil {
 		sublogger.Error().
 			Err(err).
 			Msg("Error getting the consensus_state")
-	}
-
-	if resp.Body != nil {
-		defer resp.Body.Close()
-	}
-
-	body, readErr := ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		sublogger.Error().
-			Err(readErr).
-			Msg("Error reading the consensus_state")
+		return err
 	}
 
 	consensusStateResponse := ConsensusStateResponse{}
@@ -202,18 +330,24 @@ func setMissingValidators(gaugePtr *prometheus.Gauge, sublogger *zerolog.Logger)
 		sublogger.Error().
 			Err(err).
 			Msg("Error unmarshalling the consensus_state json response")
+		return err
+	}
+
+	// the vote set is empty until the node has entered the first round of the height
+	heightVoteSet := consensusStateResponse.Result.RoundState.HeightVoteSet
+	if len(heightVoteSet) == 0 {
+		sublogger.Debug().Msg("No votes for the current height yet")
+		return nil
 	}
 
-	summaryLine := consensusStateResponse.Result.RoundState.HeightVoteSet[0].PrecommitsBitArray
-	validatorsSignedCount := strings.Count(strings.ToLower(summaryLine), "x")
-	r, _ := regexp.Compile("{[0-9]+:")
-	validatorsTotal, err := strconv.Atoi(r.FindString(summaryLine)[1 : len(r.FindString(summaryLine))-1])
+	precommits, err := ParseVoteBitArray(heightVoteSet[0].PrecommitsBitArray)
 	if err != nil {
 		sublogger.Error().
 			Err(err).
 			Msg("Error getting the validators total")
+		return err
 	}
 	gauge := *gaugePtr
-	gauge.Set(float64(validatorsTotal - validatorsSignedCount))
+	gauge.Set(float64(precommits.Validators - precommits.Voted))
 	return nil
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the buckets of the messages per block histogram
+var blockMessagesBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+type BlockResultsResponse struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		Height     string `json:"height"`
+		TxsResults []struct {
+			Code      uint32 `json:"code"`
+			Codespace string `json:"codespace"`
+			GasWanted string `json:"gas_wanted"`
+			GasUsed   string `json:"gas_used"`
+		} `json:"txs_results"`
+	} `json:"result"`
+}
+
+// DecodedTx is what the exporter needs to know about a tx.
+type DecodedTx struct {
+	MessageTypes []string
+	Fee          sdk.Coins
+}
+
+// DecodeTx decodes a protobuf encoded tx. The messages are not unpacked, so the txs with
+// messages unknown to the exporter, like the ones of the modules specific to a chain, are decoded as well.
+// The txs with an invalid fee are not decoded.
+func DecodeTx(txBytes []byte) (*DecodedTx, error) {
+	var txRaw txtypes.TxRaw
+	if err := txRaw.Unmarshal(txBytes); err != nil {
+		return nil, err
+	}
+
+	var body txtypes.TxBody
+	if err := body.Unmarshal(txRaw.BodyBytes); err != nil {
+		return nil, err
+	}
+
+	var authInfo txtypes.AuthInfo
+	if err := authInfo.Unmarshal(txRaw.AuthInfoBytes); err != nil {
+		return nil, err
+	}
+
+	decodedTx := &DecodedTx{MessageTypes: make([]string, len(body.Messages))}
+	for index, message := range body.Messages {
+		decodedTx.MessageTypes[index] = message.TypeUrl
+	}
+
+	if authInfo.Fee != nil {
+		// the fee is as sent by the signer, adding unsorted or invalid coins to others panics.
+		// A zero fee is valid in a block, the zero coins are left out.
+		fee := sdk.Coins{}
+		for _, coin := range authInfo.Fee.Amount {
+			if coin.Amount.IsNil() {
+				return nil, fmt.Errorf("no amount for the fee in %q", coin.Denom)
+			}
+
+			if !coin.Amount.IsZero() {
+				fee = append(fee, coin)
+			}
+		}
+
+		fee = fee.Sort()
+		if !fee.IsValid() {
+			return nil, fmt.Errorf("invalid fee %s", fee)
+		}
+
+		decodedTx.Fee = fee
+	}
+
+	return decodedTx, nil
+}
+
+// TxStats is the totals of the txs of the blocks followed since the exporter started.
+type TxStats struct {
+	Height        int64
+	Succeeded     uint64
+	Failed        uint64
+	Undecodable   uint64
+	GasWanted     uint64
+	GasUsed       uint64
+	Fees          sdk.Coins
+	SkippedBlocks uint64
+	// LastGasWanted and LastGasUsed are the gas of the txs of the last block.
+	LastGasWanted int64
+	LastGasUsed   int64
+}
+
+// TxTracker decodes the txs of every block followed and fetches their results from /block_results.
+type TxTracker struct {
+	chain *Chain
+	// the histogram lives as long as the exporter, it is registered on every scrape
+	messages *prometheus.HistogramVec
+
+	mutex sync.Mutex
+	stats TxStats
+}
+
+func NewTxTracker(chain *Chain) *TxTracker {
+	return &TxTracker{
+		chain: chain,
+		messages: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        "cosmos_block_messages",
+				Help:        "Number of messages of the type in the blocks containing it, since the exporter started",
+				ConstLabels: chain.ConstLabels,
+				Buckets:     blockMessagesBuckets,
+			},
+			[]string{"type"},
+		),
+	}
+}
+
+// HandleBlock records the txs of the block. The block is skipped if its results could not be fetched.
+func (t *TxTracker) HandleBlock(block *Block) {
+	if len(block.Txs) == 0 {
+		t.mutex.Lock()
+		t.stats.Height = block.Height
+		t.stats.LastGasWanted, t.stats.LastGasUsed = 0, 0
+		t.mutex.Unlock()
+		return
+	}
+
+	blockResults, err := t.fetchBlockResults(block.Height)
+	if err == nil && len(blockResults.Result.TxsResults) != len(block.Txs) {
+		err = fmt.Errorf("got %d tx results for %d txs", len(blockResults.Result.TxsResults), len(block.Txs))
+	}
+
+	if err != nil {
+		log.Warn().
+			Str("chain", t.chain.Name).
+			Int64("height", block.Height).
+			Err(err).
+			Msg("Could not get the block results, skipping the txs of the block")
+
+		t.mutex.Lock()
+		t.stats.Height = block.Height
+		t.stats.SkippedBlocks++
+		t.mutex.Unlock()
+		return
+	}
+
+	var succeeded, failed, undecodable uint64
+	var gasWanted, gasUsed int64
+	fees := sdk.NewCoins()
+	messages := make(map[string]int)
+
+	for index, txBytes := range block.Txs {
+		txResult := blockResults.Result.TxsResults[index]
+		if txResult.Code == 0 {
+			succeeded++
+		} else {
+			failed++
+		}
+
+		// the gas is an int64 encoded as a string, as every int64 of Tendermint RPC
+		txGasWanted, _ := strconv.ParseInt(txResult.GasWanted, 10, 64)
+		txGasUsed, _ := strconv.ParseInt(txResult.GasUsed, 10, 64)
+		gasWanted += txGasWanted
+		gasUsed += txGasUsed
+
+		decodedTx, err := DecodeTx(txBytes)
+		if err != nil {
+			undecodable++
+			continue
+		}
+
+		fees = fees.Add(decodedTx.Fee...)
+		for _, messageType := range decodedTx.MessageTypes {
+			messages[messageType]++
+		}
+	}
+
+	for messageType, count := range messages {
+		t.messages.With(prometheus.Labels{"type": messageType}).Observe(float64(count))
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.stats.Height = block.Height
+	t.stats.Succeeded += succeeded
+	t.stats.Failed += failed
+	t.stats.Undecodable += undecodable
+	t.stats.GasWanted += uint64(gasWanted)
+	t.stats.GasUsed += uint64(gasUsed)
+	t.stats.Fees = t.stats.Fees.Add(fees...)
+	t.stats.LastGasWanted, t.stats.LastGasUsed = gasWanted, gasUsed
+}
+
+func (t *TxTracker) fetchBlockResults(height int64) (*BlockResultsResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TendermintRPCTimeout)
+	defer cancel()
+
+	body, err := HTTPGet(ctx, t.chain.HTTPClient, fmt.Sprintf(
+		"%s/block_results?height=%d",
+		t.chain.Upstreams.Pick().TendermintRPC,
+		height,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	blockResultsResponse := BlockResultsResponse{}
+	if err := json.Unmarshal(body, &blockResultsResponse); err != nil {
+		return nil, fmt.Errorf("error unmarshalling the block_results json response: %w", err)
+	}
+
+	return &blockResultsResponse, nil
+}
+
+// Stats returns the totals of the txs of the blocks followed.
+func (t *TxTracker) Stats() TxStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.stats
+}
+
+type TxsCollector struct{}
+
+func NewTxsCollector() *TxsCollector {
+	return &TxsCollector{}
+}
+
+func (c *TxsCollector) Name() string {
+	return "txs"
+}
+
+func (c *TxsCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *TxsCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	txTrackerHeightGauge := scrape.NewGauge(
+		"cosmos_tx_tracker_height",
+		"Height of the last block the txs were recorded for",
+	)
+
+	skippedBlocksCounter := scrape.NewCounter(
+		"cosmos_tx_tracker_skipped_blocks_total",
+		"Blocks the txs were not recorded for, as their results could not be fetched",
+	)
+
+	txsCounter := scrape.NewCounterVec(
+		"cosmos_txs_total",
+		"Txs of the blocks followed since the exporter started, by result",
+		"result",
+	)
+
+	undecodableTxsCounter := scrape.NewCounter(
+		"cosmos_txs_undecodable_total",
+		"Txs which could not be decoded, e.g. amino encoded ones or with an invalid fee, not counted in the fees and messages",
+	)
+
+	gasWantedCounter := scrape.NewCounter(
+		"cosmos_txs_gas_wanted_total",
+		"Gas wanted by the txs of the blocks followed since the exporter started",
+	)
+
+	gasUsedCounter := scrape.NewCounter(
+		"cosmos_txs_gas_used_total",
+		"Gas used by the txs of the blocks followed since the exporter started",
+	)
+
+	blockGasWantedGauge := scrape.NewGauge(
+		"cosmos_block_gas_wanted",
+		"Gas wanted by the txs of the last block",
+	)
+
+	blockGasUsedGauge := scrape.NewGauge(
+		"cosmos_block_gas_used",
+		"Gas used by the txs of the last block",
+	)
+
+	feesCounter := scrape.NewCounterVec(
+		"cosmos_txs_fees_total",
+		"Fees paid by the txs of the blocks followed since the exporter started",
+		"denom", "display",
+	)
+
+	txTracker := scrape.Chain.Txs()
+	scrape.Registry.MustRegister(txTracker.messages)
+
+	stats := txTracker.Stats()
+	if stats.Height == 0 {
+		sublogger.Debug().Msg("No block followed yet")
+		return nil
+	}
+
+	txTrackerHeightGauge.Set(float64(stats.Height))
+	skippedBlocksCounter.Add(float64(stats.SkippedBlocks))
+	txsCounter.With(prometheus.Labels{"result": "success"}).Add(float64(stats.Succeeded))
+	txsCounter.With(prometheus.Labels{"result": "failed"}).Add(float64(stats.Failed))
+	undecodableTxsCounter.Add(float64(stats.Undecodable))
+	gasWantedCounter.Add(float64(stats.GasWanted))
+	gasUsedCounter.Add(float64(stats.GasUsed))
+	blockGasWantedGauge.Set(float64(stats.LastGasWanted))
+	blockGasUsedGauge.Set(float64(stats.LastGasUsed))
+
+	for _, fee := range stats.Fees {
+		value, denom, display := scrape.Chain.Denoms.CoinAmount(fee)
+		feesCounter.With(prometheus.Labels{
+			"denom":   denom,
+			"display": strconv.FormatBool(display),
+		}).Add(value)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+)
+
+// encodeTx returns the protobuf encoding of a tx with the messages and the fee given, as found in the blocks.
+func encodeTx(t *testing.T, messages []*codectypes.Any, fee *txtypes.Fee) []byte {
+	t.Helper()
+
+	bodyBytes, err := (&txtypes.TxBody{Messages: messages, Memo: "memo"}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authInfoBytes, err := (&txtypes.AuthInfo{Fee: fee}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txBytes, err := (&txtypes.TxRaw{
+		BodyBytes:     bodyBytes,
+		AuthInfoBytes: authInfoBytes,
+		Signatures:    [][]byte{[]byte("signature")},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return txBytes
+}
+
+func TestDecodeTx(t *testing.T) {
+	send, err := codectypes.NewAnyWithValue(&banktypes.MsgSend{
+		FromAddress: "cosmos1from",
+		ToAddress:   "cosmos1to",
+		Amount:      sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a message of a module specific to a chain, not registered in the exporter
+	swap := &codectypes.Any{TypeUrl: "/osmosis.gamm.v1beta1.MsgSwapExactAmountIn", Value: []byte{0x0a, 0x03, 'f', 'o', 'o'}}
+
+	tests := []struct {
+		name     string
+		txBytes  []byte
+		expected *DecodedTx
+	}{
+		{
+			name:    "known message",
+			txBytes: encodeTx(t, []*codectypes.Any{send}, &txtypes.Fee{Amount: sdk.NewCoins(sdk.NewInt64Coin("uatom", 5000)), GasLimit: 200000}),
+			expected: &DecodedTx{
+				MessageTypes: []string{"/cosmos.bank.v1beta1.MsgSend"},
+				Fee:          sdk.NewCoins(sdk.NewInt64Coin("uatom", 5000)),
+			},
+		},
+		{
+			name:    "chain specific message",
+			txBytes: encodeTx(t, []*codectypes.Any{swap, send, swap}, &txtypes.Fee{Amount: sdk.NewCoins(sdk.NewInt64Coin("uosmo", 1))}),
+			expected: &DecodedTx{
+				MessageTypes: []string{"/osmosis.gamm.v1beta1.MsgSwapExactAmountIn", "/cosmos.bank.v1beta1.MsgSend", "/osmosis.gamm.v1beta1.MsgSwapExactAmountIn"},
+				Fee:          sdk.NewCoins(sdk.NewInt64Coin("uosmo", 1)),
+			},
+		},
+		{
+			name:     "no fee",
+			txBytes:  encodeTx(t, []*codectypes.Any{send}, nil),
+			expected: &DecodedTx{MessageTypes: []string{"/cosmos.bank.v1beta1.MsgSend"}},
+		},
+		{
+			name: "unsorted fee",
+			txBytes: encodeTx(t, []*codectypes.Any{send}, &txtypes.Fee{Amount: sdk.Coins{
+				sdk.NewInt64Coin("uosmo", 2),
+				sdk.NewInt64Coin("uatom", 1),
+			}}),
+			expected: &DecodedTx{
+				MessageTypes: []string{"/cosmos.bank.v1beta1.MsgSend"},
+				Fee:          sdk.NewCoins(sdk.NewInt64Coin("uatom", 1), sdk.NewInt64Coin("uosmo", 2)),
+			},
+		},
+		{
+			name: "zero fee",
+			txBytes: encodeTx(t, []*codectypes.Any{send}, &txtypes.Fee{Amount: sdk.Coins{
+				sdk.NewInt64Coin("uatom", 0),
+				sdk.NewInt64Coin("uosmo", 2),
+			}}),
+			expected: &DecodedTx{
+				MessageTypes: []string{"/cosmos.bank.v1beta1.MsgSend"},
+				Fee:          sdk.NewCoins(sdk.NewInt64Coin("uosmo", 2)),
+			},
+		},
+		{
+			name: "duplicate fee denom",
+			txBytes: encodeTx(t, []*codectypes.Any{send}, &txtypes.Fee{Amount: sdk.Coins{
+				sdk.NewInt64Coin("uatom", 1),
+				sdk.NewInt64Coin("uatom", 2),
+			}}),
+		},
+		{
+			name: "negative fee",
+			txBytes: encodeTx(t, []*codectypes.Any{send}, &txtypes.Fee{Amount: sdk.Coins{
+				{Denom: "uatom", Amount: sdk.NewInt(-1)},
+			}}),
+		},
+		{
+			name: "invalid fee denom",
+			txBytes: encodeTx(t, []*codectypes.Any{send}, &txtypes.Fee{Amount: sdk.Coins{
+				{Denom: "1", Amount: sdk.NewInt(1)},
+			}}),
+		},
+		{
+			name:    "not a tx",
+			txBytes: []byte("not a tx"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decodedTx, err := DecodeTx(test.txBytes)
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", decodedTx)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if !reflect.DeepEqual(decodedTx.MessageTypes, test.expected.MessageTypes) {
+				t.Errorf("got messages %v, expected %v", decodedTx.MessageTypes, test.expected.MessageTypes)
+			}
+
+			if !decodedTx.Fee.IsEqual(test.expected.Fee) {
+				t.Errorf("got fee %s, expected %s", decodedTx.Fee, test.expected.Fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// upstreams lagging more than this many blocks behind the highest one are not queried
+const maxUpstreamLag = 3
+
+// Upstream is a node of the chain, queried via both gRPC and Tendermint RPC.
+type Upstream struct {
+	GrpcAddress   string
+	TendermintRPC string
+	GrpcConn      *grpc.ClientConn
+
+	mutex      sync.RWMutex
+	reachable  bool
+	catchingUp bool
+	height     int64
+}
+
+// Name identifies the upstream in the logs and the metrics.
+func (u *Upstream) Name() string {
+	return u.GrpcAddress
+}
+
+func (u *Upstream) setStatus(reachable, catchingUp bool, height int64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.reachable, u.catchingUp, u.height = reachable, catchingUp, height
+}
+
+func (u *Upstream) status() (bool, bool, int64) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.reachable, u.catchingUp, u.height
+}
+
+// unaryClientInterceptor marks the upstream as unreachable as soon as a gRPC query cannot reach it,
+// so the next scrapes fail over without waiting for the next health check.
+func (u *Upstream) unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if status.Code(err) == codes.Unavailable {
+		u.mutex.Lock()
+		u.reachable = false
+		u.mutex.Unlock()
+	}
+
+	return err
+}
+
+// UpstreamPool picks the node the queries of a scrape are sent to, based on the health
+// of the nodes checked periodically with the Tendermint RPC /status endpoint.
+type UpstreamPool struct {
+	chain      string
+	upstreams  []*Upstream
+	roundRobin bool
+	httpClient *http.Client
+	metrics    *ExporterMetrics
+
+	next uint32
+}
+
+// NewUpstreamPool connects to the nodes. The gRPC and Tendermint RPC addresses of a node have the same index.
+func NewUpstreamPool(
+	chain string,
+	grpcAddresses []string,
+	tendermintRPCs []string,
+	roundRobin bool,
+	metrics *ExporterMetrics,
+) (*UpstreamPool, error) {
+	if len(grpcAddresses) == 0 || len(grpcAddresses) != len(tendermintRPCs) {
+		return nil, fmt.Errorf(
+			"got %d gRPC and %d Tendermint RPC addresses, every node needs both",
+			len(grpcAddresses),
+			len(tendermintRPCs),
+		)
+	}
+
+	pool := &UpstreamPool{
+		chain:      chain,
+		upstreams:  make([]*Upstream, len(grpcAddresses)),
+		roundRobin: roundRobin,
+		httpClient: &http.Client{Timeout: TendermintRPCTimeout},
+		metrics:    metrics,
+	}
+
+	for index, grpcAddress := range grpcAddresses {
+		upstream := &Upstream{
+			GrpcAddress:   grpcAddress,
+			TendermintRPC: tendermintRPCs[index],
+		}
+
+		grpcConn, err := grpc.Dial(
+			grpcAddress,
+			grpc.WithInsecure(),
+			grpc.WithChainUnaryInterceptor(
+				metrics.UnaryClientInterceptor(chain),
+				GrpcTimeoutInterceptor(GrpcTimeout),
+				upstream.unaryClientInterceptor,
+			),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to gRPC node %s: %w", grpcAddress, err)
+		}
+
+		upstream.GrpcConn = grpcConn
+		pool.upstreams[index] = upstream
+	}
+
+	return pool, nil
+}
+
+// Run checks the health of the upstreams at every interval.
+func (p *UpstreamPool) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		p.Check(ctx)
+		cancel()
+	}
+}
+
+// Check queries the status of all the upstreams concurrently.
+func (p *UpstreamPool) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, upstream := range p.upstreams {
+		wg.Add(1)
+
+		go func(upstream *Upstream) {
+			defer wg.Done()
+			p.check(ctx, upstream)
+		}(upstream)
+	}
+
+	wg.Wait()
+
+	for _, upstream := range p.upstreams {
+		_, _, height := upstream.status()
+		p.metrics.ObserveUpstream(p.chain, upstream.Name(), p.isHealthy(upstream), height)
+	}
+}
+
+func (p *UpstreamPool) check(ctx context.Context, upstream *Upstream) {
+	sublogger := log.With().
+		Str("chain", p.chain).
+		Str("upstream", upstream.Name()).
+		Logger()
+
+	body, err := HTTPGet(ctx, p.httpClient, upstream.TendermintRPC+"/status")
+	if err != nil {
+		sublogger.Warn().Err(err).Msg("Upstream is unreachable")
+		upstream.setStatus(false, false, 0)
+		return
+	}
+
+	statusResponse := StatusResponse{}
+	if err := json.Unmarshal(body, &statusResponse); err != nil {
+		sublogger.Warn().Err(err).Msg("Error unmarshalling the status json response")
+		upstream.setStatus(false, false, 0)
+		return
+	}
+
+	height, err := strconv.ParseInt(statusResponse.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		sublogger.Warn().Err(err).Msg("Could not parse the latest block height")
+		upstream.setStatus(false, false, 0)
+		return
+	}
+
+	sublogger.Debug().
+		Int64("height", height).
+		Bool("catching-up", statusResponse.Result.SyncInfo.CatchingUp).
+		Msg("Checked upstream")
+	upstream.setStatus(true, statusResponse.Result.SyncInfo.CatchingUp, height)
+}
+
+func (p *UpstreamPool) maxHeight() int64 {
+	var maxHeight int64
+
+	for _, upstream := range p.upstreams {
+		if reachable, _, height := upstream.status(); reachable && height > maxHeight {
+			maxHeight = height
+		}
+	}
+
+	return maxHeight
+}
+
+// isHealthy returns true if the upstream is reachable, synced and not lagging behind the others.
+func (p *UpstreamPool) isHealthy(upstream *Upstream) bool {
+	reachable, catchingUp, height := upstream.status()
+	return reachable && !catchingUp && height >= p.maxHeight()-maxUpstreamLag
+}
+
+// Pick returns the first healthy upstream in the configured order, or rotates over the healthy upstreams
+// with round-robin. If none is healthy, the reachable upstream with the highest height is returned,
+// e.g. a lagging or syncing one, and if none is reachable the first one, as there's nothing better to query.
+func (p *UpstreamPool) Pick() *Upstream {
+	healthy := make([]*Upstream, 0, len(p.upstreams))
+	for _, upstream := range p.upstreams {
+		if p.isHealthy(upstream) {
+			healthy = append(healthy, upstream)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return p.highest()
+	}
+
+	if !p.roundRobin {
+		return healthy[0]
+	}
+
+	index := atomic.AddUint32(&p.next, 1)
+	return healthy[int(index)%len(healthy)]
+}
+
+// highest returns the first reachable upstream with the highest height, or the first upstream if none is reachable.
+func (p *UpstreamPool) highest() *Upstream {
+	picked := p.upstreams[0]
+	var pickedHeight int64 = -1
+
+	for _, upstream := range p.upstreams {
+		if reachable, _, height := upstream.status(); reachable && height > pickedHeight {
+			picked, pickedHeight = upstream, height
+		}
+	}
+
+	return picked
+}
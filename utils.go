@@ -1,8 +1,37 @@
 package main
 
-import "math/big"
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
 
-func ToNativeBalance(balance *big.Int) (float64, big.Accuracy) {
-	tokensRatioBig := new(big.Float).Quo(new(big.Float).SetInt(balance), new(big.Float).SetFloat64(DenomCoefficient))
-	return tokensRatioBig.Float64()
+// QueryErrors gathers the errors of the queries running concurrently within a single collection,
+// so the caller can tell whether the collected metrics are complete.
+type QueryErrors struct {
+	mutex  sync.Mutex
+	errors []error
+}
+
+func (e *QueryErrors) Add(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.errors = append(e.errors, err)
+}
+
+// Err returns nil if no query has failed, or an error describing all the failures otherwise.
+func (e *QueryErrors) Err() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.errors) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(e.errors))
+	for index, err := range e.errors {
+		messages[index] = err.Error()
+	}
+
+	return fmt.Errorf("%d queries failed: %s", len(e.errors), strings.Join(messages, "; "))
 }
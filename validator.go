@@ -2,170 +2,137 @@ package main
 
 import (
 	"context"
-	"net/http"
-	"sort"
+	"fmt"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/cosmos/cosmos-sdk/simapp"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	querytypes "github.com/cosmos/cosmos-sdk/types/query"
 	distributiontypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
 	slashingtypes "github.com/cosmos/cosmos-sdk/x/slashing/types"
 	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"google.golang.org/grpc"
 )
 
-func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
-	requestStart := time.Now()
-	sublogger := log.With().
-		Str("request-id", uuid.New().String()).
-		Logger()
+type ValidatorCollector struct{}
 
-	address := r.URL.Query().Get("address")
-	myAddress, err := sdk.ValAddressFromBech32(address)
+func NewValidatorCollector() *ValidatorCollector {
+	return &ValidatorCollector{}
+}
+
+func (c *ValidatorCollector) Name() string {
+	return "validator"
+}
+
+func (c *ValidatorCollector) RequiredParams() []string {
+	return []string{"address"}
+}
+
+func (c *ValidatorCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	grpcConn := scrape.Upstream.GrpcConn
+	denoms := scrape.Chain.Denoms
+	sublogger := scrape.Logger
+
+	address := scrape.Params.Get("address")
+	myAddress, err := scrape.Chain.ValAddress(address)
 	if err != nil {
 		sublogger.Error().
 			Str("address", address).
 			Err(err).
 			Msg("Could not get address")
-		return
+		return &InvalidParamError{Param: "address", Err: err}
 	}
 
-	validatorDelegationsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_delegations",
-			Help:        "Delegations of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom", "delegated_by"},
+	validatorDelegationsGauge := scrape.NewGaugeVec(
+		"cosmos_validator_delegations",
+		"Delegations of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom", "delegated_by",
 	)
 
-	validatorTokensGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_tokens",
-			Help:        "Tokens of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorTokensGauge := scrape.NewGaugeVec(
+		"cosmos_validator_tokens",
+		"Tokens of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom",
 	)
 
-	validatorDelegatorSharesGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_delegators_shares",
-			Help:        "Delegators shares of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorDelegatorSharesGauge := scrape.NewGaugeVec(
+		"cosmos_validator_delegators_shares",
+		"Delegators shares of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom",
 	)
 
-	validatorCommissionRateGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_commission_rate",
-			Help:        "Commission rate of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorCommissionRateGauge := scrape.NewGaugeVec(
+		"cosmos_validator_commission_rate",
+		"Commission rate of the Cosmos-based blockchain validator",
+		"address", "moniker",
 	)
-	validatorCommissionGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_commission",
-			Help:        "Commission of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorCommissionGauge := scrape.NewGaugeVec(
+		"cosmos_validator_commission",
+		"Commission of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom", "display",
+	)
+
+	validatorRewardsGauge := scrape.NewGaugeVec(
+		"cosmos_validator_rewards",
+		"Rewards of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom", "display",
 	)
 
-	validatorRewardsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_rewards",
-			Help:        "Rewards of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorUnbondingsGauge := scrape.NewGaugeVec(
+		"cosmos_validator_unbondings",
+		"Unbondings of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom", "unbonded_by",
 	)
 
-	validatorUnbondingsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_unbondings",
-			Help:        "Unbondings of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom", "unbonded_by"},
+	validatorRedelegationsGauge := scrape.NewGaugeVec(
+		"cosmos_validator_redelegations",
+		"Redelegations of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom", "redelegated_by", "redelegated_to",
 	)
 
-	validatorRedelegationsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_redelegations",
-			Help:        "Redelegations of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom", "redelegated_by", "redelegated_to"},
+	validatorMissedBlocksGauge := scrape.NewGaugeVec(
+		"cosmos_validator_missed_blocks",
+		"Missed blocks of the Cosmos-based blockchain validator",
+		"address", "moniker",
 	)
 
-	validatorMissedBlocksGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_missed_blocks",
-			Help:        "Missed blocks of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorRankGauge := scrape.NewGaugeVec(
+		"cosmos_validator_rank",
+		"Rank of the Cosmos-based blockchain validator by tokens, among the validators not jailed",
+		"address", "moniker",
 	)
 
-	validatorRankGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_rank",
-			Help:        "Rank of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorIsActiveGauge := scrape.NewGaugeVec(
+		"cosmos_validator_active",
+		"1 if the Cosmos-based blockchain validator is bonded and in the Tendermint validator set, 0 if no",
+		"address", "moniker",
 	)
 
-	validatorIsActiveGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_active",
-			Help:        "1 if the Cosmos-based blockchain validator is in active set, 0 if no",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorStatusGauge := scrape.NewGaugeVec(
+		"cosmos_validator_status",
+		"Status of the Cosmos-based blockchain validator",
+		"address", "moniker",
 	)
 
-	validatorStatusGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_status",
-			Help:        "Status of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorJailedGauge := scrape.NewGaugeVec(
+		"cosmos_validator_jailed",
+		"1 if the Cosmos-based blockchain validator is jailed, 0 if no",
+		"address", "moniker",
 	)
 
-	validatorJailedGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validator_jailed",
-			Help:        "1 if the Cosmos-based blockchain validator is jailed, 0 if no",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorGovVoteGauge := scrape.NewGaugeVec(
+		"cosmos_validator_gov_vote",
+		"Weight of the vote option of the Cosmos-based blockchain validator on the proposals in voting period",
+		"address", "moniker", "proposal_id", "option",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(validatorDelegationsGauge)
-	registry.MustRegister(validatorTokensGauge)
-	registry.MustRegister(validatorDelegatorSharesGauge)
-	registry.MustRegister(validatorCommissionRateGauge)
-	registry.MustRegister(validatorCommissionGauge)
-	registry.MustRegister(validatorRewardsGauge)
-	registry.MustRegister(validatorUnbondingsGauge)
-	registry.MustRegister(validatorRedelegationsGauge)
-	registry.MustRegister(validatorMissedBlocksGauge)
-	registry.MustRegister(validatorRankGauge)
-	registry.MustRegister(validatorIsActiveGauge)
-	registry.MustRegister(validatorStatusGauge)
-	registry.MustRegister(validatorJailedGauge)
+	validatorGovNotVotedGauge := scrape.NewGaugeVec(
+		"cosmos_validator_gov_not_voted",
+		"Seconds left to vote on the proposals in voting period the Cosmos-based blockchain validator has not voted on",
+		"address", "moniker", "proposal_id",
+	)
 
 	// doing this not in goroutine as we'll need the moniker value later
 	sublogger.Debug().
@@ -175,15 +142,15 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 
 	stakingClient := stakingtypes.NewQueryClient(grpcConn)
 	validator, err := stakingClient.Validator(
-		context.Background(),
-		&stakingtypes.QueryValidatorRequest{ValidatorAddr: myAddress.String()},
+		ctx,
+		&stakingtypes.QueryValidatorRequest{ValidatorAddr: myAddress},
 	)
 	if err != nil {
 		sublogger.Error().
 			Str("address", address).
 			Err(err).
 			Msg("Could not get validator")
-		return
+		return err
 	}
 
 	sublogger.Debug().
@@ -191,45 +158,22 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 		Float64("request-time", time.Since(validatorQueryStart).Seconds()).
 		Msg("Finished querying validator")
 
-	if value, err := strconv.ParseFloat(validator.Validator.Tokens.String(), 64); err != nil {
-		sublogger.Error().
-			Str("address", address).
-			Err(err).
-			Msg("Could not parse validator tokens")
-	} else {
-		validatorTokensGauge.With(prometheus.Labels{
-			"address": validator.Validator.OperatorAddress,
-			"moniker": validator.Validator.Description.Moniker,
-			"denom":   Denom,
-		}).Set(value / DenomCoefficient)
-	}
+	validatorTokensGauge.With(prometheus.Labels{
+		"address": validator.Validator.OperatorAddress,
+		"moniker": validator.Validator.Description.Moniker,
+		"denom":   denoms.Denom,
+	}).Set(denoms.BondIntAmount(validator.Validator.Tokens))
 
-	// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-	if value, err := strconv.ParseFloat(validator.Validator.DelegatorShares.String(), 64); err != nil {
-		sublogger.Error().
-			Str("address", address).
-			Err(err).
-			Msg("Could not parse delegator shares")
-	} else {
-		validatorDelegatorSharesGauge.With(prometheus.Labels{
-			"address": validator.Validator.OperatorAddress,
-			"moniker": validator.Validator.Description.Moniker,
-			"denom":   Denom,
-		}).Set(value / DenomCoefficient)
-	}
+	validatorDelegatorSharesGauge.With(prometheus.Labels{
+		"address": validator.Validator.OperatorAddress,
+		"moniker": validator.Validator.Description.Moniker,
+		"denom":   denoms.Denom,
+	}).Set(denoms.BondAmount(validator.Validator.DelegatorShares))
 
-	// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-	if rate, err := strconv.ParseFloat(validator.Validator.Commission.CommissionRates.Rate.String(), 64); err != nil {
-		sublogger.Error().
-			Str("address", address).
-			Err(err).
-			Msg("Could not parse commission rate")
-	} else {
-		validatorCommissionRateGauge.With(prometheus.Labels{
-			"address": validator.Validator.OperatorAddress,
-			"moniker": validator.Validator.Description.Moniker,
-		}).Set(rate)
-	}
+	validatorCommissionRateGauge.With(prometheus.Labels{
+		"address": validator.Validator.OperatorAddress,
+		"moniker": validator.Validator.Description.Moniker,
+	}).Set(DecToFloat64(validator.Validator.Commission.CommissionRates.Rate))
 
 	validatorStatusGauge.With(prometheus.Labels{
 		"address": validator.Validator.OperatorAddress,
@@ -249,10 +193,24 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 		"moniker": validator.Validator.Description.Moniker,
 	}).Set(jailed)
 
-	var wg sync.WaitGroup
+	// unpacked before the goroutines, the signing info and the active status both need the consensus address
+	err = validator.Validator.UnpackInterfaces(simapp.MakeTestEncodingConfig().InterfaceRegistry) // Unpack interfaces, to populate the Anys' cached values
+	if err != nil {
+		sublogger.Error().
+			Str("address", address).
+			Err(err).
+			Msg("Could not get unpack validator inferfaces")
+	}
+
+	pubKey, err := validator.Validator.GetConsAddr()
+	if err != nil {
+		sublogger.Error().
+			Str("address", address).
+			Err(err).
+			Msg("Could not get validator pubkey")
+	}
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -260,16 +218,25 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
-		stakingRes, err := stakingClient.ValidatorDelegations(
-			context.Background(),
-			&stakingtypes.QueryValidatorDelegationsRequest{ValidatorAddr: myAddress.String()},
-		)
+		var delegations []stakingtypes.DelegationResponse
+		err := scrape.Paginate("staking/ValidatorDelegations", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.ValidatorDelegations(
+				ctx,
+				&stakingtypes.QueryValidatorDelegationsRequest{ValidatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			delegations = append(delegations, stakingRes.DelegationResponses...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get validator delegations")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -277,27 +244,18 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying validator delegations")
 
-		for _, delegation := range stakingRes.DelegationResponses {
-			value, err := strconv.ParseFloat(delegation.Balance.Amount.String(), 64)
-			if err != nil {
-				log.Error().
-					Err(err).
-					Str("address", address).
-					Msg("Could not convert delegation entry")
-			} else {
-				validatorDelegationsGauge.With(prometheus.Labels{
-					"moniker":      validator.Validator.Description.Moniker,
-					"address":      delegation.Delegation.ValidatorAddress,
-					"denom":        Denom,
-					"delegated_by": delegation.Delegation.DelegatorAddress,
-				}).Set(value / DenomCoefficient)
-			}
+		for _, delegation := range delegations {
+			validatorDelegationsGauge.With(prometheus.Labels{
+				"moniker":      validator.Validator.Description.Moniker,
+				"address":      delegation.Delegation.ValidatorAddress,
+				"denom":        denoms.Denom,
+				"delegated_by": delegation.Delegation.DelegatorAddress,
+			}).Set(denoms.BondIntAmount(delegation.Balance.Amount))
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -306,15 +264,15 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 
 		distributionClient := distributiontypes.NewQueryClient(grpcConn)
 		distributionRes, err := distributionClient.ValidatorCommission(
-			context.Background(),
-			&distributiontypes.QueryValidatorCommissionRequest{ValidatorAddress: myAddress.String()},
+			ctx,
+			&distributiontypes.QueryValidatorCommissionRequest{ValidatorAddress: myAddress},
 		)
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get validator commission")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -323,26 +281,18 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			Msg("Finished querying validator commission")
 
 		for _, commission := range distributionRes.Commission.Commission {
-			// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-			value, err := strconv.ParseFloat(commission.Amount.String(), 64)
-			if err != nil {
-				log.Error().
-					Err(err).
-					Str("address", address).
-					Msg("Could not get validator commission")
-			} else {
-				validatorCommissionGauge.With(prometheus.Labels{
-					"address": address,
-					"moniker": validator.Validator.Description.Moniker,
-					"denom":   Denom,
-				}).Set(value / DenomCoefficient)
-			}
+			value, denom, display := denoms.Amount(commission.Denom, commission.Amount)
+			validatorCommissionGauge.With(prometheus.Labels{
+				"address": address,
+				"moniker": validator.Validator.Description.Moniker,
+				"denom":   denom,
+				"display": strconv.FormatBool(display),
+			}).Set(value)
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -351,15 +301,15 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 
 		distributionClient := distributiontypes.NewQueryClient(grpcConn)
 		distributionRes, err := distributionClient.ValidatorOutstandingRewards(
-			context.Background(),
-			&distributiontypes.QueryValidatorOutstandingRewardsRequest{ValidatorAddress: myAddress.String()},
+			ctx,
+			&distributiontypes.QueryValidatorOutstandingRewardsRequest{ValidatorAddress: myAddress},
 		)
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get validator rewards")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -368,25 +318,18 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			Msg("Finished querying validator rewards")
 
 		for _, reward := range distributionRes.Rewards.Rewards {
-			// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-			if value, err := strconv.ParseFloat(reward.Amount.String(), 64); err != nil {
-				sublogger.Error().
-					Str("address", address).
-					Err(err).
-					Msg("Could not get reward")
-			} else {
-				validatorRewardsGauge.With(prometheus.Labels{
-					"address": address,
-					"moniker": validator.Validator.Description.Moniker,
-					"denom":   Denom,
-				}).Set(value / DenomCoefficient)
-			}
+			value, denom, display := denoms.Amount(reward.Denom, reward.Amount)
+			validatorRewardsGauge.With(prometheus.Labels{
+				"address": address,
+				"moniker": validator.Validator.Description.Moniker,
+				"denom":   denom,
+				"display": strconv.FormatBool(display),
+			}).Set(value)
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -394,16 +337,25 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
-		stakingRes, err := stakingClient.ValidatorUnbondingDelegations(
-			context.Background(),
-			&stakingtypes.QueryValidatorUnbondingDelegationsRequest{ValidatorAddr: myAddress.String()},
-		)
+		var unbondings []stakingtypes.UnbondingDelegation
+		err := scrape.Paginate("staking/ValidatorUnbondingDelegations", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.ValidatorUnbondingDelegations(
+				ctx,
+				&stakingtypes.QueryValidatorUnbondingDelegationsRequest{ValidatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			unbondings = append(unbondings, stakingRes.UnbondingResponses...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get validator unbonding delegations")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -411,32 +363,23 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying validator unbonding delegations")
 
-		for _, unbonding := range stakingRes.UnbondingResponses {
-			var sum float64 = 0
+		for _, unbonding := range unbondings {
+			sum := sdk.ZeroInt()
 			for _, entry := range unbonding.Entries {
-				value, err := strconv.ParseFloat(entry.Balance.String(), 64)
-				if err != nil {
-					log.Error().
-						Err(err).
-						Str("address", address).
-						Msg("Could not convert unbonding delegation entry")
-				} else {
-					sum += value
-				}
+				sum = sum.Add(entry.Balance)
 			}
 
 			validatorUnbondingsGauge.With(prometheus.Labels{
 				"address":     unbonding.ValidatorAddress,
 				"moniker":     validator.Validator.Description.Moniker,
-				"denom":       Denom, // unbonding does not have denom in response for some reason
+				"denom":       denoms.Denom, // unbonding does not have denom in response for some reason
 				"unbonded_by": unbonding.DelegatorAddress,
-			}).Set(sum / DenomCoefficient)
+			}).Set(denoms.BondIntAmount(sum))
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -444,16 +387,25 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
-		stakingRes, err := stakingClient.Redelegations(
-			context.Background(),
-			&stakingtypes.QueryRedelegationsRequest{SrcValidatorAddr: myAddress.String()},
-		)
+		var redelegations []stakingtypes.RedelegationResponse
+		err := scrape.Paginate("staking/Redelegations", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.Redelegations(
+				ctx,
+				&stakingtypes.QueryRedelegationsRequest{SrcValidatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			redelegations = append(redelegations, stakingRes.RedelegationResponses...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get redelegations")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -461,69 +413,50 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying validator redelegations")
 
-		for _, redelegation := range stakingRes.RedelegationResponses {
-			var sum float64 = 0
+		for _, redelegation := range redelegations {
+			sum := sdk.ZeroInt()
 			for _, entry := range redelegation.Entries {
-				value, err := strconv.ParseFloat(entry.Balance.String(), 64)
-				if err != nil {
-					log.Error().
-						Err(err).
-						Str("address", address).
-						Msg("Could not convert redelegation entry")
-				} else {
-					sum += value
-				}
+				sum = sum.Add(entry.Balance)
 			}
 
 			validatorRedelegationsGauge.With(prometheus.Labels{
 				"address":        redelegation.Redelegation.ValidatorSrcAddress,
 				"moniker":        validator.Validator.Description.Moniker,
-				"denom":          Denom, // redelegation does not have denom in response for some reason
+				"denom":          denoms.Denom, // redelegation does not have denom in response for some reason
 				"redelegated_by": redelegation.Redelegation.DelegatorAddress,
 				"redelegated_to": redelegation.Redelegation.ValidatorDstAddress,
-			}).Set(sum / DenomCoefficient)
+			}).Set(denoms.BondIntAmount(sum))
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
 			Msg("Started querying validator signing info")
 		queryStart := time.Now()
 
-		encCfg := simapp.MakeTestEncodingConfig()
-		interfaceRegistry := encCfg.InterfaceRegistry
-
-		err := validator.Validator.UnpackInterfaces(interfaceRegistry) // Unpack interfaces, to populate the Anys' cached values
+		consAddress, err := scrape.Chain.ConsAddress(pubKey)
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
-				Msg("Could not get unpack validator inferfaces")
-		}
-
-		pubKey, err := validator.Validator.GetConsAddr()
-		if err != nil {
-			sublogger.Error().
-				Str("address", address).
-				Err(err).
-				Msg("Could not get validator pubkey")
+				Msg("Could not encode validator consensus address")
+			return err
 		}
 
 		slashingClient := slashingtypes.NewQueryClient(grpcConn)
 		slashingRes, err := slashingClient.SigningInfo(
-			context.Background(),
-			&slashingtypes.QuerySigningInfoRequest{ConsAddress: pubKey.String()},
+			ctx,
+			&slashingtypes.QuerySigningInfoRequest{ConsAddress: consAddress},
 		)
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get validator signing info")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -540,11 +473,10 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			"moniker": validator.Validator.Description.Moniker,
 			"address": address,
 		}).Set(float64(slashingRes.ValSigningInfo.MissedBlocksCounter))
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -552,20 +484,25 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
-		stakingRes, err := stakingClient.Validators(
-			context.Background(),
-			&stakingtypes.QueryValidatorsRequest{
-				Pagination: &querytypes.PageRequest{
-					Limit: Limit,
-				},
-			},
-		)
+		var validators []stakingtypes.Validator
+		err := scrape.Paginate("staking/Validators", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.Validators(
+				ctx,
+				&stakingtypes.QueryValidatorsRequest{Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			validators = append(validators, stakingRes.Validators...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get other validators")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -573,89 +510,116 @@ func ValidatorHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cli
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying validator other validators")
 
-		validators := stakingRes.Validators
-
-		// sorting by delegator shares to display rankings
-		sort.Slice(validators, func(i, j int) bool {
-			firstShares, firstErr := strconv.ParseFloat(validators[i].DelegatorShares.String(), 64)
-			secondShares, secondErr := strconv.ParseFloat(validators[j].DelegatorShares.String(), 64)
-
-			if firstErr != nil || secondErr != nil {
-				sublogger.Error().
-					Err(err).
-					Msg("Error converting delegator shares for sorting")
-				return true
-			}
-
-			return firstShares > secondShares
-		})
+		rank, ranked := ValidatorRank(validators, validator.Validator.OperatorAddress)
+		if ranked {
+			validatorRankGauge.With(prometheus.Labels{
+				"moniker": validator.Validator.Description.Moniker,
+				"address": address,
+			}).Set(float64(rank))
+		}
 
-		var validatorRank int
+		return nil
+	})
 
-		for index, validatorIterated := range validators {
-			if validatorIterated.OperatorAddress == validator.Validator.OperatorAddress {
-				validatorRank = index + 1
-				break
-			}
+	scrape.Go(func() error {
+		tendermintValidators, err := FetchTendermintValidators(ctx, scrape)
+		if err != nil {
+			return err
 		}
 
-		if validatorRank == 0 {
-			sublogger.Warn().
-				Str("address", address).
-				Msg("Could not find validator in validators list")
-			return
+		var active float64
+		if IsActive(validator.Validator, pubKey, tendermintValidators) {
+			active = 1
 		}
 
-		validatorRankGauge.With(prometheus.Labels{
+		validatorIsActiveGauge.With(prometheus.Labels{
+			"address": validator.Validator.OperatorAddress,
 			"moniker": validator.Validator.Description.Moniker,
-			"address": address,
-		}).Set(float64(validatorRank))
+		}).Set(active)
+		return nil
+	})
+
+	scrape.Go(func() error {
+		voter, err := scrape.Chain.ValidatorAccAddress(myAddress)
+		if err != nil {
+			sublogger.Error().
+				Str("address", address).
+				Err(err).
+				Msg("Could not get validator account address")
+			return err
+		}
 
 		sublogger.Debug().
 			Str("address", address).
-			Msg("Started querying validator params")
-		queryStart = time.Now()
+			Msg("Started querying validator votes")
+		queryStart := time.Now()
+
+		govClient := govtypes.NewQueryClient(grpcConn)
+		var proposals []govtypes.Proposal
+		err = scrape.Paginate(
+			fmt.Sprintf("gov/Proposals?status=%s", govtypes.StatusVotingPeriod),
+			func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+				govRes, err := govClient.Proposals(
+					ctx,
+					&govtypes.QueryProposalsRequest{ProposalStatus: govtypes.StatusVotingPeriod, Pagination: pageRequest},
+				)
+				if err != nil {
+					return nil, err
+				}
 
-		paramsRes, err := stakingClient.Params(
-			context.Background(),
-			&stakingtypes.QueryParamsRequest{},
+				proposals = append(proposals, govRes.Proposals...)
+				return govRes.Pagination, nil
+			},
 		)
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
-				Msg("Could not get params")
-			return
+				Msg("Could not get proposals")
+			return err
 		}
 
-		sublogger.Debug().
-			Str("address", address).
-			Float64("request-time", time.Since(queryStart).Seconds()).
-			Msg("Finished querying validator params")
+		for _, proposal := range proposals {
+			proposalID := strconv.FormatUint(proposal.ProposalId, 10)
+
+			voteRes, err := govClient.Vote(
+				ctx,
+				&govtypes.QueryVoteRequest{ProposalId: proposal.ProposalId, Voter: voter},
+			)
+			if IsVoteNotFound(err) {
+				validatorGovNotVotedGauge.With(prometheus.Labels{
+					"address":     validator.Validator.OperatorAddress,
+					"moniker":     validator.Validator.Description.Moniker,
+					"proposal_id": proposalID,
+				}).Set(time.Until(proposal.VotingEndTime).Seconds())
+				continue
+			}
 
-		// golang doesn't have a ternary operator, so we have to stick with this ugly solution
-		var active float64
+			if err != nil {
+				sublogger.Error().
+					Str("address", address).
+					Str("proposal_id", proposalID).
+					Err(err).
+					Msg("Could not get vote")
+				return err
+			}
 
-		if validatorRank <= int(paramsRes.Params.MaxValidators) {
-			active = 1
-		} else {
-			active = 0
+			for _, option := range voteRes.Vote.Options {
+				validatorGovVoteGauge.With(prometheus.Labels{
+					"address":     validator.Validator.OperatorAddress,
+					"moniker":     validator.Validator.Description.Moniker,
+					"proposal_id": proposalID,
+					"option":      VoteOptionLabel(option.Option),
+				}).Set(DecToFloat64(option.Weight))
+			}
 		}
 
-		validatorIsActiveGauge.With(prometheus.Labels{
-			"address": validator.Validator.OperatorAddress,
-			"moniker": validator.Validator.Description.Moniker,
-		}).Set(active)
-	}()
-	wg.Add(1)
-
-	wg.Wait()
-
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/validator?address="+address).
-		Float64("request-time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+		sublogger.Debug().
+			Str("address", address).
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying validator votes")
+		return nil
+	})
+
+	return scrape.Wait()
 }
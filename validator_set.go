@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ValidatorSetChanges is how a validator entered, left and changed in the Tendermint validator set
+// since the exporter started following the blocks.
+type ValidatorSetChanges struct {
+	// Address is the hex address of the consensus key of the validator, as in Tendermint RPC.
+	Address string
+
+	Entries      uint64
+	Exits        uint64
+	PowerChanges uint64
+	// VotingPower is the voting power in the last set, 0 if the validator is out of it.
+	VotingPower int64
+	// LastPowerChange is the difference of voting power of the last change, negative if it decreased.
+	LastPowerChange int64
+	LastChange      time.Time
+}
+
+// StakingChanges is how the bond status of a validator changed between the scrapes.
+type StakingChanges struct {
+	OperatorAddress string
+	Moniker         string
+
+	// StatusChanges are the transitions to every status, by lowercased status without prefix, e.g. "unbonding".
+	// A validator removed from the staking validators, once unbonded without delegations, changes to "removed".
+	StatusChanges map[string]uint64
+	Jailings      uint64
+	LastChange    time.Time
+
+	status  stakingtypes.BondStatus
+	jailed  bool
+	removed bool
+}
+
+// ValidatorSetTracker diffs the successive Tendermint validator sets of the blocks followed,
+// and the successive staking validators of the scrapes.
+type ValidatorSetTracker struct {
+	chain *Chain
+
+	mutex      sync.Mutex
+	height     int64
+	lastChange time.Time
+	// the validator set of the last block followed, nil until the first block
+	set        map[string]int64
+	validators map[string]*ValidatorSetChanges
+
+	// the staking validators of the last scrape, by operator address, nil until the first scrape
+	staking map[string]*StakingChanges
+}
+
+func NewValidatorSetTracker(chain *Chain) *ValidatorSetTracker {
+	return &ValidatorSetTracker{chain: chain, validators: make(map[string]*ValidatorSetChanges)}
+}
+
+func (t *ValidatorSetTracker) validator(address string) *ValidatorSetChanges {
+	validator, ok := t.validators[address]
+	if !ok {
+		validator = &ValidatorSetChanges{Address: address}
+		t.validators[address] = validator
+	}
+
+	return validator
+}
+
+// HandleBlock diffs the validator set of the commit the block includes with the previous one.
+// The first set is the baseline, its validators are not counted as entering the set.
+func (t *ValidatorSetTracker) HandleBlock(block *Block) {
+	if block.LastCommit == nil {
+		return
+	}
+
+	set := make(map[string]int64, len(block.LastCommit.Validators))
+	for _, blockValidator := range block.LastCommit.Validators {
+		set[blockValidator.Address] = blockValidator.VotingPower
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.height = block.LastCommit.Height
+
+	if t.set == nil {
+		for address, votingPower := range set {
+			t.validator(address).VotingPower = votingPower
+		}
+
+		t.set = set
+		return
+	}
+
+	changed := false
+
+	for address, votingPower := range set {
+		previousVotingPower, ok := t.set[address]
+		if ok && previousVotingPower == votingPower {
+			continue
+		}
+
+		validator := t.validator(address)
+		if !ok {
+			validator.Entries++
+		} else {
+			validator.PowerChanges++
+		}
+
+		validator.LastPowerChange = votingPower - previousVotingPower
+		validator.VotingPower = votingPower
+		validator.LastChange = block.Time
+		changed = true
+	}
+
+	for address, previousVotingPower := range t.set {
+		if _, ok := set[address]; ok {
+			continue
+		}
+
+		validator := t.validator(address)
+		validator.Exits++
+		validator.LastPowerChange = -previousVotingPower
+		validator.VotingPower = 0
+		validator.LastChange = block.Time
+		changed = true
+	}
+
+	if changed {
+		log.Info().
+			Str("chain", t.chain.Name).
+			Int64("height", block.LastCommit.Height).
+			Int("validators", len(set)).
+			Msg("Validator set changed")
+		t.lastChange = block.Time
+	}
+
+	t.set = set
+}
+
+// Snapshot returns the height of the last set diffed, the time of its last change and the changes of every validator.
+func (t *ValidatorSetTracker) Snapshot() (int64, time.Time, []ValidatorSetChanges) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	validators := make([]ValidatorSetChanges, 0, len(t.validators))
+	for _, validator := range t.validators {
+		validators = append(validators, *validator)
+	}
+
+	return t.height, t.lastChange, validators
+}
+
+// UpdateStaking diffs the staking validators with the ones of the previous call and returns
+// the changes of every validator, including the ones removed since. The first call is the baseline, no change is counted.
+func (t *ValidatorSetTracker) UpdateStaking(validators []stakingtypes.Validator, now time.Time) []StakingChanges {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	baseline := t.staking == nil
+	if baseline {
+		t.staking = make(map[string]*StakingChanges, len(validators))
+	}
+
+	seen := make(map[string]bool, len(validators))
+
+	for _, validator := range validators {
+		seen[validator.OperatorAddress] = true
+
+		changes, ok := t.staking[validator.OperatorAddress]
+		if !ok {
+			changes = &StakingChanges{
+				OperatorAddress: validator.OperatorAddress,
+				StatusChanges:   make(map[string]uint64),
+				status:          validator.Status,
+				jailed:          validator.Jailed,
+			}
+			t.staking[validator.OperatorAddress] = changes
+
+			// a validator created since the previous scrape enters with its current status
+			if !baseline {
+				changes.StatusChanges[BondStatusLabel(validator.Status)]++
+				changes.LastChange = now
+			}
+		}
+
+		changes.Moniker = validator.Description.Moniker
+
+		// a validator created again with the operator address of a removed one enters with its current status
+		if changes.removed {
+			changes.StatusChanges[BondStatusLabel(validator.Status)]++
+			changes.LastChange = now
+			changes.removed = false
+		} else if validator.Status != changes.status {
+			changes.StatusChanges[BondStatusLabel(validator.Status)]++
+			changes.LastChange = now
+		}
+
+		if validator.Jailed && !changes.jailed {
+			changes.Jailings++
+			changes.LastChange = now
+		}
+
+		changes.status, changes.jailed = validator.Status, validator.Jailed
+	}
+
+	for operatorAddress, changes := range t.staking {
+		if seen[operatorAddress] || changes.removed {
+			continue
+		}
+
+		changes.StatusChanges["removed"]++
+		changes.LastChange = now
+		changes.removed = true
+	}
+
+	stakingChanges := make([]StakingChanges, 0, len(t.staking))
+	for _, changes := range t.staking {
+		statusChanges := make(map[string]uint64, len(changes.StatusChanges))
+		for status, count := range changes.StatusChanges {
+			statusChanges[status] = count
+		}
+
+		stakingChange := *changes
+		stakingChange.StatusChanges = statusChanges
+		stakingChanges = append(stakingChanges, stakingChange)
+	}
+
+	return stakingChanges
+}
+
+// BondStatusLabel returns the bond status lowercased and without its prefix, e.g. "bonded".
+func BondStatusLabel(status stakingtypes.BondStatus) string {
+	return strings.ToLower(strings.TrimPrefix(status.String(), "BOND_STATUS_"))
+}
+
+type ValidatorSetCollector struct{}
+
+func NewValidatorSetCollector() *ValidatorSetCollector {
+	return &ValidatorSetCollector{}
+}
+
+func (c *ValidatorSetCollector) Name() string {
+	return "validator-set"
+}
+
+func (c *ValidatorSetCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *ValidatorSetCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	setHeightGauge := scrape.NewGauge(
+		"cosmos_validator_set_tracker_height",
+		"Height of the last validator set diffed",
+	)
+
+	setLastChangeGauge := scrape.NewGauge(
+		"cosmos_validator_set_last_change_timestamp",
+		"Time of the last change of the validator set, as a Unix timestamp, 0 if it did not change since the exporter started",
+	)
+
+	entriesCounter := scrape.NewCounterVec(
+		"cosmos_validator_set_entries_total",
+		"Times the Cosmos-based blockchain validator entered the validator set since the exporter started",
+		"address", "moniker", "cons_address",
+	)
+
+	exitsCounter := scrape.NewCounterVec(
+		"cosmos_validator_set_exits_total",
+		"Times the Cosmos-based blockchain validator left the validator set since the exporter started",
+		"address", "moniker", "cons_address",
+	)
+
+	powerChangesCounter := scrape.NewCounterVec(
+		"cosmos_validator_set_power_changes_total",
+		"Times the voting power of the Cosmos-based blockchain validator changed in the validator set since the exporter started",
+		"address", "moniker", "cons_address",
+	)
+
+	votingPowerGauge := scrape.NewGaugeVec(
+		"cosmos_validator_set_voting_power",
+		"Voting power of the Cosmos-based blockchain validator in the last validator set, 0 if it left it",
+		"address", "moniker", "cons_address",
+	)
+
+	lastPowerChangeGauge := scrape.NewGaugeVec(
+		"cosmos_validator_set_last_power_change",
+		"Voting power gained by the Cosmos-based blockchain validator on its last change, negative if it lost some",
+		"address", "moniker", "cons_address",
+	)
+
+	validatorLastChangeGauge := scrape.NewGaugeVec(
+		"cosmos_validator_set_validator_last_change_timestamp",
+		"Time of the last change of the Cosmos-based blockchain validator in the validator set, as a Unix timestamp",
+		"address", "moniker", "cons_address",
+	)
+
+	statusChangesCounter := scrape.NewCounterVec(
+		"cosmos_validator_status_changes_total",
+		"Times the bond status of the Cosmos-based blockchain validator changed to the status, between the scrapes since the exporter started",
+		"address", "moniker", "status",
+	)
+
+	jailingsCounter := scrape.NewCounterVec(
+		"cosmos_validator_jailings_total",
+		"Times the Cosmos-based blockchain validator was jailed, between the scrapes since the exporter started",
+		"address", "moniker",
+	)
+
+	stakingLastChangeGauge := scrape.NewGaugeVec(
+		"cosmos_validator_status_last_change_timestamp",
+		"Time of the scrape the bond status or the jailing of the Cosmos-based blockchain validator was seen changing, as a Unix timestamp",
+		"address", "moniker",
+	)
+
+	tracker := scrape.Chain.ValidatorSet()
+
+	validators, err := FetchValidators(ctx, scrape)
+	validatorsByConsAddress := ValidatorsByConsAddress(sublogger, validators)
+
+	// an incomplete list of validators would be diffed as validators removed. The validators are diffed
+	// by operator address, including the ones whose consensus key could not be decoded.
+	if err == nil {
+		for _, changes := range tracker.UpdateStaking(validators, time.Now()) {
+			labels := prometheus.Labels{"address": changes.OperatorAddress, "moniker": changes.Moniker}
+			jailingsCounter.With(labels).Add(float64(changes.Jailings))
+
+			if !changes.LastChange.IsZero() {
+				stakingLastChangeGauge.With(labels).Set(float64(changes.LastChange.Unix()))
+			}
+
+			for status, count := range changes.StatusChanges {
+				statusChangesCounter.With(prometheus.Labels{
+					"address": changes.OperatorAddress,
+					"moniker": changes.Moniker,
+					"status":  status,
+				}).Add(float64(count))
+			}
+		}
+	}
+
+	height, lastChange, setChanges := tracker.Snapshot()
+	setHeightGauge.Set(float64(height))
+	if !lastChange.IsZero() {
+		setLastChangeGauge.Set(float64(lastChange.Unix()))
+	}
+
+	if len(setChanges) == 0 {
+		sublogger.Debug().Msg("No block followed yet")
+		return err
+	}
+
+	for _, changes := range setChanges {
+		labels := ValidatorLabels(validatorsByConsAddress, changes.Address)
+
+		entriesCounter.With(labels).Add(float64(changes.Entries))
+		exitsCounter.With(labels).Add(float64(changes.Exits))
+		powerChangesCounter.With(labels).Add(float64(changes.PowerChanges))
+		votingPowerGauge.With(labels).Set(float64(changes.VotingPower))
+		lastPowerChangeGauge.With(labels).Set(float64(changes.LastPowerChange))
+
+		if !changes.LastChange.IsZero() {
+			validatorLastChangeGauge.With(labels).Set(float64(changes.LastChange.Unix()))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/ed25519"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/rs/zerolog"
+)
+
+func stakingValidator(operatorAddress string, status stakingtypes.BondStatus, jailed bool) stakingtypes.Validator {
+	return stakingtypes.Validator{
+		OperatorAddress: operatorAddress,
+		Status:          status,
+		Jailed:          jailed,
+		Description:     stakingtypes.Description{Moniker: "moniker-" + operatorAddress},
+	}
+}
+
+// expectedStakingChanges are the changes of a validator, lastScrape the index from 1 of the scrape it last changed on.
+type expectedStakingChanges struct {
+	statusChanges map[string]uint64
+	jailings      uint64
+	lastScrape    int
+}
+
+func TestValidatorSetTrackerUpdateStaking(t *testing.T) {
+	bonded, unbonding, unbonded := stakingtypes.Bonded, stakingtypes.Unbonding, stakingtypes.Unbonded
+
+	tests := []struct {
+		name     string
+		scrapes  [][]stakingtypes.Validator
+		expected map[string]expectedStakingChanges
+	}{
+		{
+			name:    "baseline",
+			scrapes: [][]stakingtypes.Validator{{stakingValidator("A", bonded, false), stakingValidator("B", unbonded, true)}},
+			expected: map[string]expectedStakingChanges{
+				"A": {statusChanges: map[string]uint64{}},
+				"B": {statusChanges: map[string]uint64{}},
+			},
+		},
+		{
+			name: "status changed and jailed",
+			scrapes: [][]stakingtypes.Validator{
+				{stakingValidator("A", bonded, false)},
+				{stakingValidator("A", unbonding, true)},
+				{stakingValidator("A", unbonded, true)},
+			},
+			expected: map[string]expectedStakingChanges{
+				"A": {statusChanges: map[string]uint64{"unbonding": 1, "unbonded": 1}, jailings: 1, lastScrape: 3},
+			},
+		},
+		{
+			name: "created",
+			scrapes: [][]stakingtypes.Validator{
+				{stakingValidator("A", bonded, false)},
+				{stakingValidator("A", bonded, false), stakingValidator("B", unbonded, false)},
+			},
+			expected: map[string]expectedStakingChanges{
+				"A": {statusChanges: map[string]uint64{}},
+				"B": {statusChanges: map[string]uint64{"unbonded": 1}, lastScrape: 2},
+			},
+		},
+		{
+			name: "removed",
+			scrapes: [][]stakingtypes.Validator{
+				{stakingValidator("A", bonded, false), stakingValidator("B", unbonded, false)},
+				{stakingValidator("A", bonded, false)},
+				{stakingValidator("A", bonded, false)},
+			},
+			expected: map[string]expectedStakingChanges{
+				"A": {statusChanges: map[string]uint64{}},
+				"B": {statusChanges: map[string]uint64{"removed": 1}, lastScrape: 2},
+			},
+		},
+		{
+			name: "created again after removed",
+			scrapes: [][]stakingtypes.Validator{
+				{stakingValidator("B", unbonded, false)},
+				{},
+				{stakingValidator("B", unbonded, false)},
+			},
+			expected: map[string]expectedStakingChanges{
+				"B": {statusChanges: map[string]uint64{"removed": 1, "unbonded": 1}, lastScrape: 3},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := NewValidatorSetTracker(&Chain{})
+
+			var stakingChanges []StakingChanges
+			for index, validators := range test.scrapes {
+				stakingChanges = tracker.UpdateStaking(validators, time.Unix(int64(index+1), 0))
+			}
+
+			if len(stakingChanges) != len(test.expected) {
+				t.Fatalf("got changes for %d validators, expected %d", len(stakingChanges), len(test.expected))
+			}
+
+			for _, changes := range stakingChanges {
+				expected, ok := test.expected[changes.OperatorAddress]
+				if !ok {
+					t.Errorf("%s: unexpected changes", changes.OperatorAddress)
+					continue
+				}
+
+				if changes.Moniker != "moniker-"+changes.OperatorAddress {
+					t.Errorf("%s: got moniker %q", changes.OperatorAddress, changes.Moniker)
+				}
+
+				if !reflect.DeepEqual(changes.StatusChanges, expected.statusChanges) {
+					t.Errorf("%s: got status changes %v, expected %v", changes.OperatorAddress, changes.StatusChanges, expected.statusChanges)
+				}
+
+				if changes.Jailings != expected.jailings {
+					t.Errorf("%s: got %d jailings, expected %d", changes.OperatorAddress, changes.Jailings, expected.jailings)
+				}
+
+				var expectedLastChange time.Time
+				if expected.lastScrape > 0 {
+					expectedLastChange = time.Unix(int64(expected.lastScrape), 0)
+				}
+
+				if !changes.LastChange.Equal(expectedLastChange) {
+					t.Errorf("%s: got last change %v, expected %v", changes.OperatorAddress, changes.LastChange, expectedLastChange)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatorSetTrackerUndecodableValidator(t *testing.T) {
+	consensusPubkey, err := codectypes.NewAnyWithValue(ed25519.GenPrivKey().PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodable := stakingValidator("A", stakingtypes.Bonded, false)
+	decodable.ConsensusPubkey = consensusPubkey
+
+	// the consensus key of a type unknown to the exporter cannot be decoded
+	undecodable := stakingValidator("B", stakingtypes.Bonded, false)
+	undecodable.ConsensusPubkey = &codectypes.Any{TypeUrl: "/chain.crypto.PubKey", Value: []byte{0x0a, 0x01, 0x01}}
+
+	validators := []stakingtypes.Validator{decodable, undecodable}
+
+	logger := zerolog.Nop()
+	validatorsByConsAddress := ValidatorsByConsAddress(&logger, validators)
+	if len(validatorsByConsAddress) != 1 {
+		t.Fatalf("got %d validators by consensus address, expected only the decodable one", len(validatorsByConsAddress))
+	}
+
+	for _, validator := range validatorsByConsAddress {
+		if validator.OperatorAddress != "A" {
+			t.Errorf("got validator %s by consensus address, expected A", validator.OperatorAddress)
+		}
+	}
+
+	tracker := NewValidatorSetTracker(&Chain{})
+	for index := 1; index <= 3; index++ {
+		for _, changes := range tracker.UpdateStaking(validators, time.Unix(int64(index), 0)) {
+			if len(changes.StatusChanges) != 0 || !changes.LastChange.IsZero() {
+				t.Errorf("scrape %d, %s: got status changes %v, expected none", index, changes.OperatorAddress, changes.StatusChanges)
+			}
+		}
+	}
+}
@@ -2,249 +2,315 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"sort"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/cosmos/cosmos-sdk/simapp"
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	querytypes "github.com/cosmos/cosmos-sdk/types/query"
 	slashingtypes "github.com/cosmos/cosmos-sdk/x/slashing/types"
 	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"google.golang.org/grpc"
 )
 
-func ValidatorsHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
+type TendermintValidatorsResponse struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		BlockHeight string `json:"block_height"`
+		Validators  []struct {
+			Address     string `json:"address"`
+			VotingPower string `json:"voting_power"`
+		} `json:"validators"`
+		Count string `json:"count"`
+		Total string `json:"total"`
+	} `json:"result"`
+}
+
+type ValidatorsCollector struct{}
+
+func NewValidatorsCollector() *ValidatorsCollector {
+	return &ValidatorsCollector{}
+}
+
+func (c *ValidatorsCollector) Name() string {
+	return "validators"
+}
+
+func (c *ValidatorsCollector) RequiredParams() []string {
+	return nil
+}
+
+func (c *ValidatorsCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	grpcConn := scrape.Upstream.GrpcConn
+	denoms := scrape.Chain.Denoms
+	sublogger := scrape.Logger
+
 	encCfg := simapp.MakeTestEncodingConfig()
 	interfaceRegistry := encCfg.InterfaceRegistry
 
-	requestStart := time.Now()
+	validatorsCommissionGauge := scrape.NewGaugeVec(
+		"cosmos_validators_commission",
+		"Commission of the Cosmos-based blockchain validator",
+		"address", "moniker",
+	)
 
-	sublogger := log.With().
-		Str("request-id", uuid.New().String()).
-		Logger()
+	validatorsStatusGauge := scrape.NewGaugeVec(
+		"cosmos_validators_status",
+		"Status of the Cosmos-based blockchain validator",
+		"address", "moniker",
+	)
 
-	validatorsCommissionGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_commission",
-			Help:        "Commission of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorsEstimatedAPRGauge := scrape.NewGaugeVec(
+		"cosmos_validators_estimated_apr",
+		"Estimated APR of the delegators of the Cosmos-based blockchain validator, net of commission and community tax",
+		"address", "moniker",
 	)
 
-	validatorsStatusGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_status",
-			Help:        "Status of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorsJailedGauge := scrape.NewGaugeVec(
+		"cosmos_validators_jailed",
+		"Jailed status of the Cosmos-based blockchain validator",
+		"address", "moniker",
 	)
 
-	validatorsJailedGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_jailed",
-			Help:        "Jailed status of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorsTokensGauge := scrape.NewGaugeVec(
+		"cosmos_validators_tokens",
+		"Tokens of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom",
 	)
 
-	validatorsTokensGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_tokens",
-			Help:        "Tokens of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorsDelegatorSharesGauge := scrape.NewGaugeVec(
+		"cosmos_validators_delegator_shares",
+		"Delegator shares of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom",
 	)
 
-	validatorsDelegatorSharesGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_delegator_shares",
-			Help:        "Delegator shares of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorsMinSelfDelegationGauge := scrape.NewGaugeVec(
+		"cosmos_validators_min_self_delegation",
+		"Self declared minimum self delegation shares of the Cosmos-based blockchain validator",
+		"address", "moniker", "denom",
 	)
 
-	validatorsMinSelfDelegationGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_min_self_delegation",
-			Help:        "Self declared minimum self delegation shares of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker", "denom"},
+	validatorsMissedBlocksGauge := scrape.NewGaugeVec(
+		"cosmos_validators_missed_blocks",
+		"Missed blocks of the Cosmos-based blockchain validator",
+		"address", "moniker",
 	)
 
-	validatorsMissedBlocksGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_missed_blocks",
-			Help:        "Missed blocks of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorsRankGauge := scrape.NewGaugeVec(
+		"cosmos_validators_rank",
+		"Rank of the Cosmos-based blockchain validator by tokens, among the validators not jailed",
+		"address", "moniker",
 	)
 
-	validatorsRankGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_rank",
-			Help:        "Rank of the Cosmos-based blockchain validator",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorsBondedRankGauge := scrape.NewGaugeVec(
+		"cosmos_validators_rank_bonded",
+		"Rank of the Cosmos-based blockchain validator by tokens, among the bonded validators",
+		"address", "moniker",
 	)
 
-	validatorsIsActiveGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_validators_active",
-			Help:        "1 if the Cosmos-based blockchain validator is in active set, 0 if no",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "moniker"},
+	validatorsIsActiveGauge := scrape.NewGaugeVec(
+		"cosmos_validators_active",
+		"1 if the Cosmos-based blockchain validator is bonded and in the Tendermint validator set, 0 if no",
+		"address", "moniker",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(validatorsCommissionGauge)
-	registry.MustRegister(validatorsStatusGauge)
-	registry.MustRegister(validatorsJailedGauge)
-	registry.MustRegister(validatorsTokensGauge)
-	registry.MustRegister(validatorsDelegatorSharesGauge)
-	registry.MustRegister(validatorsMinSelfDelegationGauge)
-	registry.MustRegister(validatorsMissedBlocksGauge)
-	registry.MustRegister(validatorsRankGauge)
-	registry.MustRegister(validatorsIsActiveGauge)
+	validatorsVotingPowerRatioGauge := scrape.NewGaugeVec(
+		"cosmos_validators_voting_power_ratio",
+		"Fraction of the voting power of the active set held by the Cosmos-based blockchain validator",
+		"address", "moniker",
+	)
+
+	validatorsCumulativeVotingPowerRatioGauge := scrape.NewGaugeVec(
+		"cosmos_validators_cumulative_voting_power_ratio",
+		"Fraction of the voting power of the active set held by the Cosmos-based blockchain validator and the ones ranked above it",
+		"address", "moniker",
+	)
+
+	validatorsCutoffGapGauge := scrape.NewGaugeVec(
+		"cosmos_validators_active_set_cutoff_gap",
+		"Tokens the Cosmos-based blockchain validator is ahead of the first validator out of the active set, or behind the last validator of the set if negative",
+		"address", "moniker", "denom",
+	)
+
+	nakamotoCoefficientGauge := scrape.NewGaugeVec(
+		"cosmos_validators_nakamoto_coefficient",
+		"Fewest validators holding enough voting power to halt the chain (1/3) or to commit blocks on their own (2/3)",
+		"threshold",
+	)
+
+	giniCoefficientGauge := scrape.NewGauge(
+		"cosmos_validators_gini_coefficient",
+		"Gini coefficient of the voting power of the active set, 0 if all the validators have the same",
+	)
 
 	var validators []stakingtypes.Validator
+	// the distribution of the voting power is only computed over all the validators
+	var validatorsFetched bool
 	var signingInfos []slashingtypes.ValidatorSigningInfo
 	var validatorSetLength uint32
 
-	var wg sync.WaitGroup
-
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().Msg("Started querying validators")
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
-		validatorsResponse, err := stakingClient.Validators(
-			context.Background(),
-			&stakingtypes.QueryValidatorsRequest{
-				Pagination: &querytypes.PageRequest{
-					Limit: Limit,
-				},
-			},
-		)
+		err := scrape.Paginate("staking/Validators", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			validatorsResponse, err := stakingClient.Validators(
+				ctx,
+				&stakingtypes.QueryValidatorsRequest{Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			validators = append(validators, validatorsResponse.Validators...)
+			return validatorsResponse.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().Err(err).Msg("Could not get validators")
-			return
+			return err
 		}
 
 		sublogger.Debug().
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying validators")
-		validators = validatorsResponse.Validators
-		// sorting by delegator shares to display rankings
-		sort.Slice(validators, func(i, j int) bool {
-			firstShares, firstErr := strconv.ParseFloat(validators[i].DelegatorShares.String(), 64)
-			secondShares, secondErr := strconv.ParseFloat(validators[j].DelegatorShares.String(), 64)
-
-			if firstErr != nil || secondErr != nil {
-				sublogger.Error().
-					Err(err).
-					Msg("Error converting delegator shares for sorting")
-				return true
-			}
+		SortValidatorsByTokens(validators)
+		validatorsFetched = true
+		return nil
+	})
 
-			return firstShares > secondShares
-		})
-	}()
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().Msg("Started querying validators signing infos")
 		queryStart := time.Now()
 
 		slashingClient := slashingtypes.NewQueryClient(grpcConn)
-		signingInfosResponse, err := slashingClient.SigningInfos(
-			context.Background(),
-			&slashingtypes.QuerySigningInfosRequest{
-				Pagination: &querytypes.PageRequest{
-					Limit: Limit,
-				},
-			},
-		)
+		err := scrape.Paginate("slashing/SigningInfos", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			signingInfosResponse, err := slashingClient.SigningInfos(
+				ctx,
+				&slashingtypes.QuerySigningInfosRequest{Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			signingInfos = append(signingInfos, signingInfosResponse.Info...)
+			return signingInfosResponse.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Err(err).
 				Msg("Could not get validators signing infos")
-			return
+			return err
 		}
 
 		sublogger.Debug().
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying validator signing infos")
-		signingInfos = signingInfosResponse.Info
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().Msg("Started querying staking params")
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(grpcConn)
 		paramsResponse, err := stakingClient.Params(
-			context.Background(),
+			ctx,
 			&stakingtypes.QueryParamsRequest{},
 		)
 		if err != nil {
 			sublogger.Error().
 				Err(err).
 				Msg("Could not get staking params")
-			return
+			return err
 		}
 
 		sublogger.Debug().
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying staking params")
 		validatorSetLength = paramsResponse.Params.MaxValidators
-	}()
-	wg.Add(1)
+		return nil
+	})
+
+	// the validators in the set of the latest block, by hex address of their consensus key
+	var tendermintValidators map[string]int64
 
-	wg.Wait()
+	scrape.Go(func() error {
+		var err error
+		tendermintValidators, err = FetchTendermintValidators(ctx, scrape)
+		return err
+	})
+
+	var apr *StakingAPR
+
+	scrape.Go(func() error {
+		var err error
+		apr, err = FetchStakingAPR(ctx, scrape, grpcConn, scrape.Chain.Capabilities)
+		return err
+	})
+
+	scrapeErr := scrape.Wait()
 
 	sublogger.Debug().
 		Int("signingLength", len(signingInfos)).
 		Int("validatorsLength", len(validators)).
 		Msg("Validators info")
 
-	for index, validator := range validators {
-		// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-		rate, err := strconv.ParseFloat(validator.Commission.CommissionRates.Rate.String(), 64)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("address", validator.OperatorAddress).
-				Msg("Could not get commission")
-		} else {
-			validatorsCommissionGauge.With(prometheus.Labels{
-				"address": validator.OperatorAddress,
-				"moniker": validator.Description.Moniker,
-			}).Set(rate)
+	ranks, bondedRanks, rankedTokens := RankValidators(validators)
+
+	var distribution *VotingPowerDistribution
+	var cutoffGaps []sdk.Int
+
+	if validatorsFetched {
+		var votingPowers []sdk.Int
+		for _, validator := range validators {
+			if validator.IsBonded() {
+				votingPowers = append(votingPowers, validator.Tokens)
+			}
 		}
 
+		distribution = NewVotingPowerDistribution(votingPowers)
+		nakamotoCoefficientGauge.With(prometheus.Labels{"threshold": "1/3"}).Set(float64(distribution.NakamotoHalt))
+		nakamotoCoefficientGauge.With(prometheus.Labels{"threshold": "2/3"}).Set(float64(distribution.NakamotoControl))
+		giniCoefficientGauge.Set(DecToFloat64(distribution.Gini))
+
+		if validatorSetLength != 0 {
+			cutoffGaps = CutoffGaps(rankedTokens, int(validatorSetLength))
+		}
+	}
+
+	cumulativeVotingPower := sdk.ZeroInt()
+
+	for _, validator := range validators {
+		validatorsCommissionGauge.With(prometheus.Labels{
+			"address": validator.OperatorAddress,
+			"moniker": validator.Description.Moniker,
+		}).Set(DecToFloat64(validator.Commission.CommissionRates.Rate))
+
 		validatorsStatusGauge.With(prometheus.Labels{
 			"address": validator.OperatorAddress,
 			"moniker": validator.Description.Moniker,
 		}).Set(float64(validator.Status))
 
+		// only the bonded validators get rewards
+		if apr != nil {
+			estimatedAPR := sdk.ZeroDec()
+			if validator.IsBonded() {
+				estimatedAPR = apr.ValidatorAPR(validator.Commission.CommissionRates.Rate)
+			}
+
+			validatorsEstimatedAPRGauge.With(prometheus.Labels{
+				"address": validator.OperatorAddress,
+				"moniker": validator.Description.Moniker,
+			}).Set(DecToFloat64(estimatedAPR))
+		}
+
 		// golang doesn't have a ternary operator, so we have to stick with this ugly solution
 		var jailed float64
 
@@ -258,59 +324,67 @@ func ValidatorsHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cl
 			"moniker": validator.Description.Moniker,
 		}).Set(jailed)
 
-		// validatorsTokensGauge.With(prometheus.Labels{
-		// 	"address": validator.OperatorAddress,
-		// 	"moniker": validator.Description.Moniker,
-		// 	"denom":   Denom,
-		// }).Set(float64(validator.Tokens.Int64()) / DenomCoefficient)
+		validatorsTokensGauge.With(prometheus.Labels{
+			"address": validator.OperatorAddress,
+			"moniker": validator.Description.Moniker,
+			"denom":   denoms.Denom,
+		}).Set(denoms.BondIntAmount(validator.Tokens))
+
+		validatorsDelegatorSharesGauge.With(prometheus.Labels{
+			"address": validator.OperatorAddress,
+			"moniker": validator.Description.Moniker,
+			"denom":   denoms.Denom,
+		}).Set(denoms.BondAmount(validator.DelegatorShares))
 
-		if value, err := strconv.ParseFloat(validator.Tokens.String(), 64); err != nil {
-			sublogger.Error().
-				Str("address", validator.OperatorAddress).
-				Err(err).
-				Msg("Could not parse validator tokens")
-		} else {
-			validatorsTokensGauge.With(prometheus.Labels{
+		validatorsMinSelfDelegationGauge.With(prometheus.Labels{
+			"address": validator.OperatorAddress,
+			"moniker": validator.Description.Moniker,
+			"denom":   denoms.Denom,
+		}).Set(denoms.BondIntAmount(validator.MinSelfDelegation))
+
+		// only the bonded validators have voting power
+		if distribution != nil {
+			votingPower := sdk.ZeroInt()
+			if validator.IsBonded() {
+				votingPower = validator.Tokens
+				cumulativeVotingPower = cumulativeVotingPower.Add(votingPower)
+
+				validatorsCumulativeVotingPowerRatioGauge.With(prometheus.Labels{
+					"address": validator.OperatorAddress,
+					"moniker": validator.Description.Moniker,
+				}).Set(DecToFloat64(distribution.Share(cumulativeVotingPower)))
+			}
+
+			validatorsVotingPowerRatioGauge.With(prometheus.Labels{
 				"address": validator.OperatorAddress,
 				"moniker": validator.Description.Moniker,
-				"denom":   Denom,
-			}).Set(value / DenomCoefficient)
+			}).Set(DecToFloat64(distribution.Share(votingPower)))
 		}
 
-		// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-		if value, err := strconv.ParseFloat(validator.DelegatorShares.String(), 64); err != nil {
-			sublogger.Error().
-				Str("address", validator.OperatorAddress).
-				Err(err).
-				Msg("Could not parse delegator shares")
-		} else {
-			validatorsDelegatorSharesGauge.With(prometheus.Labels{
+		rank, ranked := ranks[validator.OperatorAddress]
+		if ranked {
+			validatorsRankGauge.With(prometheus.Labels{
 				"address": validator.OperatorAddress,
 				"moniker": validator.Description.Moniker,
-				"denom":   Denom,
-			}).Set(value / DenomCoefficient)
+			}).Set(float64(rank))
+
+			if cutoffGaps != nil {
+				validatorsCutoffGapGauge.With(prometheus.Labels{
+					"address": validator.OperatorAddress,
+					"moniker": validator.Description.Moniker,
+					"denom":   denoms.Denom,
+				}).Set(denoms.BondIntAmount(cutoffGaps[rank-1]))
+			}
 		}
 
-		// validatorsMinSelfDelegationGauge.With(prometheus.Labels{
-		// 	"address": validator.OperatorAddress,
-		// 	"moniker": validator.Description.Moniker,
-		// 	"denom":   Denom,
-		// }).Set(float64(validator.MinSelfDelegation.Int64()) / DenomCoefficient)
-
-		if value, err := strconv.ParseFloat(validator.MinSelfDelegation.String(), 64); err != nil {
-			sublogger.Error().
-				Str("address", validator.OperatorAddress).
-				Err(err).
-				Msg("Could not parse validator tokens")
-		} else {
-			validatorsMinSelfDelegationGauge.With(prometheus.Labels{
+		if bondedRank, ok := bondedRanks[validator.OperatorAddress]; ok {
+			validatorsBondedRankGauge.With(prometheus.Labels{
 				"address": validator.OperatorAddress,
 				"moniker": validator.Description.Moniker,
-				"denom":   Denom,
-			}).Set(value / DenomCoefficient)
+			}).Set(float64(bondedRank))
 		}
 
-		err = validator.UnpackInterfaces(interfaceRegistry) // Unpack interfaces, to populate the Anys' cached values
+		err := validator.UnpackInterfaces(interfaceRegistry) // Unpack interfaces, to populate the Anys' cached values
 		if err != nil {
 			sublogger.Error().
 				Str("address", validator.OperatorAddress).
@@ -326,11 +400,31 @@ func ValidatorsHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cl
 				Msg("Could not get validator pubkey")
 		}
 
+		if tendermintValidators != nil {
+			var active float64
+			if IsActive(validator, pubKey, tendermintValidators) {
+				active = 1
+			}
+
+			validatorsIsActiveGauge.With(prometheus.Labels{
+				"address": validator.OperatorAddress,
+				"moniker": validator.Description.Moniker,
+			}).Set(active)
+		}
+
+		consAddress, err := scrape.Chain.ConsAddress(pubKey)
+		if err != nil {
+			sublogger.Error().
+				Str("address", validator.OperatorAddress).
+				Err(err).
+				Msg("Could not encode validator consensus address")
+		}
+
 		var signingInfo slashingtypes.ValidatorSigningInfo
 		found := false
 
 		for _, signingInfoIterated := range signingInfos {
-			if pubKey.String() == signingInfoIterated.Address {
+			if consAddress == signingInfoIterated.Address {
 				found = true
 				signingInfo = signingInfoIterated
 				break
@@ -354,34 +448,119 @@ func ValidatorsHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Cl
 				Str("address", validator.OperatorAddress).
 				Msg("Validator is not active, not returning missed blocks amount.")
 		}
+	}
 
-		validatorsRankGauge.With(prometheus.Labels{
-			"address": validator.OperatorAddress,
-			"moniker": validator.Description.Moniker,
-		}).Set(float64(index + 1))
+	return scrapeErr
+}
 
-		if validatorSetLength != 0 {
-			// golang doesn't have a ternary operator, so we have to stick with this ugly solution
-			var active float64
+// SortValidatorsByTokens sorts the validators by tokens, which are their voting power once bonded, to rank them.
+func SortValidatorsByTokens(validators []stakingtypes.Validator) {
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i].Tokens.GT(validators[j].Tokens)
+	})
+}
 
-			if index+1 <= int(validatorSetLength) {
-				active = 1
-			} else {
-				active = 0
+// IsActive returns whether the validator is bonded and in the Tendermint validator set, by hex consensus address.
+// The Tendermint validator set only follows the bonded validators a couple of blocks later, a validator is active
+// once both agree.
+func IsActive(validator stakingtypes.Validator, consAddress sdk.ConsAddress, tendermintValidators map[string]int64) bool {
+	_, inSet := tendermintValidators[strings.ToUpper(hex.EncodeToString(consAddress))]
+	return validator.IsBonded() && inSet
+}
+
+// RankValidators ranks the validators, sorted by tokens, from 1. The ranks are by operator address, among
+// the validators not jailed, which cannot be bonded, and among the bonded validators. The tokens of the
+// validators not jailed are returned in the order of their ranks.
+func RankValidators(validators []stakingtypes.Validator) (map[string]int, map[string]int, []sdk.Int) {
+	ranks := make(map[string]int, len(validators))
+	bondedRanks := make(map[string]int, len(validators))
+	var rankedTokens []sdk.Int
+
+	for _, validator := range validators {
+		if !validator.Jailed {
+			rankedTokens = append(rankedTokens, validator.Tokens)
+			ranks[validator.OperatorAddress] = len(rankedTokens)
+		}
+
+		if validator.IsBonded() {
+			bondedRanks[validator.OperatorAddress] = len(bondedRanks) + 1
+		}
+	}
+
+	return ranks, bondedRanks, rankedTokens
+}
+
+// ValidatorRank returns the rank of the validator among the validators not jailed, as RankValidators,
+// and false if it is jailed or not among the validators.
+func ValidatorRank(validators []stakingtypes.Validator, operatorAddress string) (int, bool) {
+	sorted := make([]stakingtypes.Validator, len(validators))
+	copy(sorted, validators)
+	SortValidatorsByTokens(sorted)
+
+	ranks, _, _ := RankValidators(sorted)
+	rank, ranked := ranks[operatorAddress]
+	return rank, ranked
+}
+
+// FetchTendermintValidators returns the voting power of the validators in the set of the latest block,
+// by hex address of their consensus key.
+func FetchTendermintValidators(ctx context.Context, scrape *Scrape) (map[string]int64, error) {
+	sublogger := scrape.Logger
+
+	sublogger.Debug().Msg("Started querying Tendermint validators")
+	queryStart := time.Now()
+
+	validators := make(map[string]int64)
+	// the next pages are fetched at the height of the first one, in case a new block comes meanwhile
+	var height string
+
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/validators?page=%d&per_page=%d", scrape.Upstream.TendermintRPC, page, validatorsPerPage)
+		if height != "" {
+			url += "&height=" + height
+		}
+
+		body, err := HTTPGet(ctx, scrape.Chain.HTTPClient, url)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Error getting the Tendermint validators")
+			return nil, err
+		}
+
+		validatorsResponse := TendermintValidatorsResponse{}
+		if err := json.Unmarshal(body, &validatorsResponse); err != nil {
+			sublogger.Error().Err(err).Msg("Error unmarshalling the Tendermint validators json response")
+			return nil, err
+		}
+
+		total, err := strconv.Atoi(validatorsResponse.Result.Total)
+		if err != nil {
+			sublogger.Error().Err(err).Msg("Could not parse the number of Tendermint validators")
+			return nil, err
+		}
+
+		for _, validator := range validatorsResponse.Result.Validators {
+			votingPower, err := strconv.ParseInt(validator.VotingPower, 10, 64)
+			if err != nil {
+				sublogger.Error().
+					Str("address", validator.Address).
+					Err(err).
+					Msg("Could not parse the voting power of the Tendermint validator")
+				return nil, err
 			}
 
-			validatorsIsActiveGauge.With(prometheus.Labels{
-				"address": validator.OperatorAddress,
-				"moniker": validator.Description.Moniker,
-			}).Set(active)
+			validators[validator.Address] = votingPower
+		}
+
+		height = validatorsResponse.Result.BlockHeight
+
+		if len(validators) >= total || len(validatorsResponse.Result.Validators) == 0 {
+			break
 		}
 	}
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/validators").
-		Float64("request-time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+	sublogger.Debug().
+		Float64("request-time", time.Since(queryStart).Seconds()).
+		Msg("Finished querying Tendermint validators")
+
+	return validators, nil
 }
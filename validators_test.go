@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/rs/zerolog"
+)
+
+func TestRankValidators(t *testing.T) {
+	validator := func(operatorAddress string, tokens int64, status stakingtypes.BondStatus, jailed bool) stakingtypes.Validator {
+		return stakingtypes.Validator{OperatorAddress: operatorAddress, Tokens: sdk.NewInt(tokens), Status: status, Jailed: jailed}
+	}
+
+	tests := []struct {
+		name         string
+		validators   []stakingtypes.Validator
+		ranks        map[string]int
+		bondedRanks  map[string]int
+		rankedTokens []sdk.Int
+	}{
+		{
+			name:        "no validators",
+			ranks:       map[string]int{},
+			bondedRanks: map[string]int{},
+		},
+		{
+			name: "all bonded",
+			validators: []stakingtypes.Validator{
+				validator("A", 50, stakingtypes.Bonded, false),
+				validator("B", 40, stakingtypes.Bonded, false),
+			},
+			ranks:        map[string]int{"A": 1, "B": 2},
+			bondedRanks:  map[string]int{"A": 1, "B": 2},
+			rankedTokens: ints(50, 40),
+		},
+		{
+			// a jailed validator keeps its tokens until it unbonds, it is not ranked meanwhile
+			name: "jailed",
+			validators: []stakingtypes.Validator{
+				validator("A", 60, stakingtypes.Unbonding, true),
+				validator("B", 50, stakingtypes.Bonded, false),
+				validator("C", 40, stakingtypes.Unbonded, true),
+				validator("D", 30, stakingtypes.Bonded, false),
+			},
+			ranks:        map[string]int{"B": 1, "D": 2},
+			bondedRanks:  map[string]int{"B": 1, "D": 2},
+			rankedTokens: ints(50, 30),
+		},
+		{
+			// a validator entering the set is not bonded until the end of the block
+			name: "not bonded yet",
+			validators: []stakingtypes.Validator{
+				validator("A", 50, stakingtypes.Bonded, false),
+				validator("B", 45, stakingtypes.Unbonded, false),
+				validator("C", 40, stakingtypes.Bonded, false),
+			},
+			ranks:        map[string]int{"A": 1, "B": 2, "C": 3},
+			bondedRanks:  map[string]int{"A": 1, "C": 2},
+			rankedTokens: ints(50, 45, 40),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranks, bondedRanks, rankedTokens := RankValidators(test.validators)
+
+			if !reflect.DeepEqual(ranks, test.ranks) {
+				t.Errorf("got ranks %v, expected %v", ranks, test.ranks)
+			}
+
+			if !reflect.DeepEqual(bondedRanks, test.bondedRanks) {
+				t.Errorf("got bonded ranks %v, expected %v", bondedRanks, test.bondedRanks)
+			}
+
+			if len(rankedTokens) != len(test.rankedTokens) {
+				t.Fatalf("got %d ranked tokens, expected %d", len(rankedTokens), len(test.rankedTokens))
+			}
+
+			for index, tokens := range rankedTokens {
+				if !tokens.Equal(test.rankedTokens[index]) {
+					t.Errorf("rank %d: got %s tokens, expected %s", index+1, tokens, test.rankedTokens[index])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchTendermintValidators(t *testing.T) {
+	const total = validatorsPerPage + 50
+
+	var heights []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		heights = append(heights, r.URL.Query().Get("height"))
+
+		response := TendermintValidatorsResponse{}
+		response.Result.BlockHeight = "1000"
+		response.Result.Total = strconv.Itoa(total)
+
+		for index := (page - 1) * validatorsPerPage; index < page*validatorsPerPage && index < total; index++ {
+			response.Result.Validators = append(response.Result.Validators, struct {
+				Address     string `json:"address"`
+				VotingPower string `json:"voting_power"`
+			}{Address: fmt.Sprintf("%040X", index), VotingPower: strconv.Itoa(index + 1)})
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	logger := zerolog.Nop()
+	scrape := &Scrape{
+		Chain:    &Chain{HTTPClient: server.Client()},
+		Upstream: &Upstream{TendermintRPC: server.URL},
+		Logger:   &logger,
+	}
+
+	validators, err := FetchTendermintValidators(context.Background(), scrape)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if len(validators) != total {
+		t.Errorf("got %d validators, expected %d", len(validators), total)
+	}
+
+	if votingPower := validators[fmt.Sprintf("%040X", total-1)]; votingPower != total {
+		t.Errorf("got voting power %d for the last validator, expected %d", votingPower, total)
+	}
+
+	// the next pages are fetched at the height of the first one
+	if expected := []string{"", "1000"}; !reflect.DeepEqual(heights, expected) {
+		t.Errorf("got the pages at heights %q, expected %q", heights, expected)
+	}
+}
+
+func TestValidatorRank(t *testing.T) {
+	// not sorted, as fetched from the staking module
+	validators := []stakingtypes.Validator{
+		{OperatorAddress: "A", Tokens: sdk.NewInt(30), DelegatorShares: sdk.NewDec(30), Status: stakingtypes.Bonded},
+		{OperatorAddress: "B", Tokens: sdk.NewInt(60), DelegatorShares: sdk.NewDec(60), Status: stakingtypes.Unbonding, Jailed: true},
+		// slashed, it has more shares than tokens
+		{OperatorAddress: "C", Tokens: sdk.NewInt(40), DelegatorShares: sdk.NewDec(100), Status: stakingtypes.Bonded},
+		{OperatorAddress: "D", Tokens: sdk.NewInt(50), DelegatorShares: sdk.NewDec(50), Status: stakingtypes.Bonded},
+	}
+
+	tests := []struct {
+		operatorAddress string
+		rank            int
+		ranked          bool
+	}{
+		{operatorAddress: "D", rank: 1, ranked: true},
+		{operatorAddress: "C", rank: 2, ranked: true},
+		{operatorAddress: "A", rank: 3, ranked: true},
+		{operatorAddress: "B"},
+		{operatorAddress: "E"},
+	}
+
+	for _, test := range tests {
+		rank, ranked := ValidatorRank(validators, test.operatorAddress)
+		if rank != test.rank || ranked != test.ranked {
+			t.Errorf("%s: got rank %d (ranked %t), expected %d (ranked %t)", test.operatorAddress, rank, ranked, test.rank, test.ranked)
+		}
+	}
+
+	if validators[0].OperatorAddress != "A" {
+		t.Error("validators sorted in place")
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	consAddress := sdk.ConsAddress([]byte{0x0a, 0x1b, 0x2c})
+	tendermintValidators := map[string]int64{"0A1B2C": 10}
+
+	tests := []struct {
+		name        string
+		status      stakingtypes.BondStatus
+		consAddress sdk.ConsAddress
+		tendermint  map[string]int64
+		expected    bool
+	}{
+		{name: "bonded and in the set", status: stakingtypes.Bonded, consAddress: consAddress, tendermint: tendermintValidators, expected: true},
+		{name: "bonded, not in the set yet", status: stakingtypes.Bonded, consAddress: consAddress, tendermint: map[string]int64{}},
+		{name: "unbonding, still in the set", status: stakingtypes.Unbonding, consAddress: consAddress, tendermint: tendermintValidators},
+		{name: "undecodable consensus key", status: stakingtypes.Bonded, tendermint: tendermintValidators},
+	}
+
+	for _, test := range tests {
+		validator := stakingtypes.Validator{OperatorAddress: "A", Status: test.status}
+		if active := IsActive(validator, test.consAddress, test.tendermint); active != test.expected {
+			t.Errorf("%s: got %t, expected %t", test.name, active, test.expected)
+		}
+	}
+}
@@ -2,125 +2,130 @@ package main
 
 import (
 	"context"
-	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	querytypes "github.com/cosmos/cosmos-sdk/types/query"
 	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	distributiontypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
 	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"google.golang.org/grpc"
 )
 
-func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.ClientConn) {
-	network := grpcConn
+type WalletCollector struct {
+	networks Networks
+}
+
+func NewWalletCollector(networks Networks) *WalletCollector {
+	return &WalletCollector{networks: networks}
+}
+
+func (c *WalletCollector) Name() string {
+	return "wallet"
+}
+
+func (c *WalletCollector) RequiredParams() []string {
+	return []string{"address"}
+}
+
+func (c *WalletCollector) Collect(ctx context.Context, scrape *Scrape) error {
+	sublogger := scrape.Logger
+
+	// the wallet is queried on the chain, unless another network is asked for
+	network := scrape.Upstream.GrpcConn
+	denoms, denomTraces := scrape.Chain.Denoms, scrape.Chain.DenomTraces
+	capabilities := scrape.Chain.Capabilities
+	parseAddress := scrape.Chain.AccAddress
 
-	requestStart := time.Now()
+	if networkName := scrape.Params.Get("network"); networkName != "" {
+		optionalNetwork, err := c.networks.Get(networkName)
+		if err != nil {
+			sublogger.Error().
+				Str("network", networkName).
+				Err(err).
+				Msg("Could not get network")
+			return err
+		}
 
-	sublogger := log.With().
-		Str("request-id", uuid.New().String()).
-		Logger()
+		network = optionalNetwork.GrpcConn
+		denoms, denomTraces = optionalNetwork.Denoms, optionalNetwork.DenomTraces
+		capabilities = optionalNetwork.Capabilities
+		parseAddress = optionalNetwork.AccAddress
+	}
 
-	address := r.URL.Query().Get("address")
-	myAddress, err := sdk.AccAddressFromBech32(address)
+	address := scrape.Params.Get("address")
+	myAddress, err := parseAddress(address)
 	if err != nil {
 		sublogger.Error().
 			Str("address", address).
 			Err(err).
 			Msg("Could not get address")
-		return
+		return &InvalidParamError{Param: "address", Err: err}
 	}
 
-	optionalNetwork := r.URL.Query().Get("network")
-	if optionalNetwork != "" {
-		net, err := grpc.Dial(
-			OptionalNetworks[optionalNetwork],
-			grpc.WithInsecure(),
-		)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Could not connect to gRPC node")
-			return
-		}
-		network = net
-	}
-
-	walletBalanceGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_wallet_balance",
-			Help:        "Balance of the Cosmos-based blockchain wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "denom"},
+	walletBalanceGauge := scrape.NewGaugeVec(
+		"cosmos_wallet_balance",
+		"Balance of the Cosmos-based blockchain wallet",
+		"address", "denom", "display", "base_denom", "path", "source_channel",
 	)
 
-	walletDelegationGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_wallet_delegations",
-			Help:        "Delegations of the Cosmos-based blockchain wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "denom", "delegated_to"},
+	walletDelegationGauge := scrape.NewGaugeVec(
+		"cosmos_wallet_delegations",
+		"Delegations of the Cosmos-based blockchain wallet",
+		"address", "denom", "delegated_to",
 	)
 
-	walletRedelegationGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_wallet_redelegations",
-			Help:        "Redlegations of the Cosmos-based blockchain wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "denom", "redelegated_from", "redelegated_to"},
+	walletRedelegationGauge := scrape.NewGaugeVec(
+		"cosmos_wallet_redelegations",
+		"Redlegations of the Cosmos-based blockchain wallet",
+		"address", "denom", "redelegated_from", "redelegated_to",
 	)
 
-	walletUnbondingsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_wallet_unbondings",
-			Help:        "Unbondings of the Cosmos-based blockchain wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "denom", "unbonded_from"},
+	walletUnbondingsGauge := scrape.NewGaugeVec(
+		"cosmos_wallet_unbondings",
+		"Unbondings of the Cosmos-based blockchain wallet",
+		"address", "denom", "unbonded_from",
 	)
 
-	walletRewardsGauge := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name:        "cosmos_wallet_rewards",
-			Help:        "Rewards of the Cosmos-based blockchain wallet",
-			ConstLabels: ConstLabels,
-		},
-		[]string{"address", "denom", "validator_address"},
+	walletProjectedRewardsGauge := scrape.NewGaugeVec(
+		"cosmos_wallet_projected_yearly_rewards",
+		"Rewards the delegations of the Cosmos-based blockchain wallet would earn in a year at the current APR",
+		"address", "denom", "validator_address",
 	)
 
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(walletBalanceGauge)
-	registry.MustRegister(walletDelegationGauge)
-	registry.MustRegister(walletUnbondingsGauge)
-	registry.MustRegister(walletRedelegationGauge)
-	registry.MustRegister(walletRewardsGauge)
-
-	var wg sync.WaitGroup
+	walletRewardsGauge := scrape.NewGaugeVec(
+		"cosmos_wallet_rewards",
+		"Rewards of the Cosmos-based blockchain wallet",
+		"address", "denom", "display", "validator_address",
+	)
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().
 			Str("address", address).
 			Msg("Started querying balance")
 		queryStart := time.Now()
 
 		bankClient := banktypes.NewQueryClient(network)
-		bankRes, err := bankClient.AllBalances(
-			context.Background(),
-			&banktypes.QueryAllBalancesRequest{Address: myAddress.String()},
-		)
+		var balances []sdk.Coin
+		err := scrape.Paginate("bank/AllBalances", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			bankRes, err := bankClient.AllBalances(
+				ctx,
+				&banktypes.QueryAllBalancesRequest{Address: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			balances = append(balances, bankRes.Balances...)
+			return bankRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get balance")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -128,41 +133,56 @@ func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Client
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying balance")
 
-		for _, balance := range bankRes.Balances {
-			// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-			if value, err := strconv.ParseFloat(balance.Amount.String(), 64); err != nil {
-				sublogger.Error().
-					Str("address", address).
-					Err(err).
-					Msg("Could not parse balance")
-			} else {
-				walletBalanceGauge.With(prometheus.Labels{
-					"address": address,
-					"denom":   balance.Denom,
-				}).Set(value)
-			}
+		balanceDenoms := make([]string, len(balances))
+		for index, balance := range balances {
+			balanceDenoms[index] = balance.Denom
 		}
-	}()
-	wg.Add(1)
 
-	go func() {
-		defer wg.Done()
+		// the IBC denoms whose trace could not be fetched are labelled as they are
+		if err := denomTraces.Resolve(ctx, scrape, network, balanceDenoms); err != nil {
+			sublogger.Warn().Err(err).Msg("Could not resolve all the IBC denom traces")
+		}
+
+		for _, balance := range balances {
+			value, denom, display := denoms.CoinAmount(balance)
+			labels := denomTraces.Get(balance.Denom).Labels()
+			labels["address"] = address
+			labels["denom"] = denom
+			labels["display"] = strconv.FormatBool(display)
+			walletBalanceGauge.With(labels).Set(value)
+		}
+		return nil
+	})
+
+	var delegations []stakingtypes.DelegationResponse
+	var delegatorValidators []stakingtypes.Validator
+	var apr *StakingAPR
+
+	scrape.Go(func() error {
 		sublogger.Debug().
 			Str("address", address).
 			Msg("Started querying delegations")
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(network)
-		stakingRes, err := stakingClient.DelegatorDelegations(
-			context.Background(),
-			&stakingtypes.QueryDelegatorDelegationsRequest{DelegatorAddr: myAddress.String()},
-		)
+		err := scrape.Paginate("staking/DelegatorDelegations", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.DelegatorDelegations(
+				ctx,
+				&stakingtypes.QueryDelegatorDelegationsRequest{DelegatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			delegations = append(delegations, stakingRes.DelegationResponses...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get delegations")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -170,42 +190,42 @@ func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Client
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying delegations")
 
-		for _, delegation := range stakingRes.DelegationResponses {
-			// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-			if value, err := strconv.ParseFloat(delegation.Balance.Amount.String(), 64); err != nil {
-				sublogger.Error().
-					Str("address", address).
-					Err(err).
-					Msg("Could not get delegation")
-			} else {
-				walletDelegationGauge.With(prometheus.Labels{
-					"address":      address,
-					"denom":        Denom,
-					"delegated_to": delegation.Delegation.ValidatorAddress,
-				}).Set(value / DenomCoefficient)
-			}
+		for _, delegation := range delegations {
+			walletDelegationGauge.With(prometheus.Labels{
+				"address":      address,
+				"denom":        denoms.Denom,
+				"delegated_to": delegation.Delegation.ValidatorAddress,
+			}).Set(denoms.BondIntAmount(delegation.Balance.Amount))
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().
 			Str("address", address).
 			Msg("Started querying unbonding delegations")
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(network)
-		stakingRes, err := stakingClient.DelegatorUnbondingDelegations(
-			context.Background(),
-			&stakingtypes.QueryDelegatorUnbondingDelegationsRequest{DelegatorAddr: myAddress.String()},
-		)
+		var unbondings []stakingtypes.UnbondingDelegation
+		err := scrape.Paginate("staking/DelegatorUnbondingDelegations", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.DelegatorUnbondingDelegations(
+				ctx,
+				&stakingtypes.QueryDelegatorUnbondingDelegationsRequest{DelegatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			unbondings = append(unbondings, stakingRes.UnbondingResponses...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get unbonding delegations")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -213,47 +233,47 @@ func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Client
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying unbonding delegations")
 
-		for _, unbonding := range stakingRes.UnbondingResponses {
-			var sum float64 = 0
+		for _, unbonding := range unbondings {
+			sum := sdk.ZeroInt()
 			for _, entry := range unbonding.Entries {
-				// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-				if value, err := strconv.ParseFloat(entry.Balance.String(), 64); err != nil {
-					sublogger.Error().
-						Str("address", address).
-						Err(err).
-						Msg("Could not parse unbonding delegation")
-				} else {
-					sum += value
-				}
+				sum = sum.Add(entry.Balance)
 			}
 
 			walletUnbondingsGauge.With(prometheus.Labels{
 				"address":       unbonding.DelegatorAddress,
-				"denom":         Denom, // unbonding does not have denom in response for some reason
+				"denom":         denoms.Denom, // unbonding does not have denom in response for some reason
 				"unbonded_from": unbonding.ValidatorAddress,
-			}).Set(sum / DenomCoefficient)
+			}).Set(denoms.BondIntAmount(sum))
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 		sublogger.Debug().
 			Str("address", address).
 			Msg("Started querying redelegations")
 		queryStart := time.Now()
 
 		stakingClient := stakingtypes.NewQueryClient(network)
-		stakingRes, err := stakingClient.Redelegations(
-			context.Background(),
-			&stakingtypes.QueryRedelegationsRequest{DelegatorAddr: myAddress.String()},
-		)
+		var redelegations []stakingtypes.RedelegationResponse
+		err := scrape.Paginate("staking/Redelegations", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.Redelegations(
+				ctx,
+				&stakingtypes.QueryRedelegationsRequest{DelegatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			redelegations = append(redelegations, stakingRes.RedelegationResponses...)
+			return stakingRes.Pagination, nil
+		})
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get redelegations")
-			return
+			return err
 		}
 
 		sublogger.Debug().
@@ -261,32 +281,23 @@ func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Client
 			Float64("request-time", time.Since(queryStart).Seconds()).
 			Msg("Finished querying redelegations")
 
-		for _, redelegation := range stakingRes.RedelegationResponses {
-			var sum float64 = 0
+		for _, redelegation := range redelegations {
+			sum := sdk.ZeroInt()
 			for _, entry := range redelegation.Entries {
-				// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-				if value, err := strconv.ParseFloat(entry.Balance.String(), 64); err != nil {
-					sublogger.Error().
-						Str("address", address).
-						Err(err).
-						Msg("Could not parse redelegation")
-				} else {
-					sum += value
-				}
+				sum = sum.Add(entry.Balance)
 			}
 
 			walletRedelegationGauge.With(prometheus.Labels{
 				"address":          redelegation.Redelegation.DelegatorAddress,
-				"denom":            Denom, // redelegation does not have denom in response for some reason
+				"denom":            denoms.Denom, // redelegation does not have denom in response for some reason
 				"redelegated_from": redelegation.Redelegation.ValidatorSrcAddress,
 				"redelegated_to":   redelegation.Redelegation.ValidatorDstAddress,
-			}).Set(sum / DenomCoefficient)
+			}).Set(denoms.BondIntAmount(sum))
 		}
-	}()
-	wg.Add(1)
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
+	scrape.Go(func() error {
 
 		sublogger.Debug().
 			Str("address", address).
@@ -295,15 +306,15 @@ func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Client
 
 		distributionClient := distributiontypes.NewQueryClient(network)
 		distributionRes, err := distributionClient.DelegationTotalRewards(
-			context.Background(),
-			&distributiontypes.QueryDelegationTotalRewardsRequest{DelegatorAddress: myAddress.String()},
+			ctx,
+			&distributiontypes.QueryDelegationTotalRewardsRequest{DelegatorAddress: myAddress},
 		)
 		if err != nil {
 			sublogger.Error().
 				Str("address", address).
 				Err(err).
 				Msg("Could not get rewards")
-			return
+			return err
 		}
 		sublogger.Debug().
 			Str("address", address).
@@ -312,31 +323,90 @@ func WalletHandler(w http.ResponseWriter, r *http.Request, grpcConn *grpc.Client
 
 		for _, reward := range distributionRes.Rewards {
 			for _, entry := range reward.Reward {
-				// because cosmos's dec doesn't have .toFloat64() method or whatever and returns everything as int
-				if value, err := strconv.ParseFloat(entry.Amount.String(), 64); err != nil {
-					sublogger.Error().
-						Str("address", address).
-						Err(err).
-						Msg("Could not parse reward")
-				} else {
-					walletRewardsGauge.With(prometheus.Labels{
-						"address":           address,
-						"denom":             Denom,
-						"validator_address": reward.ValidatorAddress,
-					}).Set(value / DenomCoefficient)
-				}
+				value, denom, display := denoms.Amount(entry.Denom, entry.Amount)
+				walletRewardsGauge.With(prometheus.Labels{
+					"address":           address,
+					"denom":             denom,
+					"display":           strconv.FormatBool(display),
+					"validator_address": reward.ValidatorAddress,
+				}).Set(value)
 			}
 		}
-	}()
-	wg.Add(1)
-
-	wg.Wait()
-
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
-	sublogger.Info().
-		Str("method", "GET").
-		Str("endpoint", "/metrics/wallet?address="+address).
-		Float64("request-time", time.Since(requestStart).Seconds()).
-		Msg("Request processed")
+		return nil
+	})
+
+	scrape.Go(func() error {
+		sublogger.Debug().
+			Str("address", address).
+			Msg("Started querying delegator validators")
+		queryStart := time.Now()
+
+		stakingClient := stakingtypes.NewQueryClient(network)
+		err := scrape.Paginate("staking/DelegatorValidators", func(pageRequest *querytypes.PageRequest) (*querytypes.PageResponse, error) {
+			stakingRes, err := stakingClient.DelegatorValidators(
+				ctx,
+				&stakingtypes.QueryDelegatorValidatorsRequest{DelegatorAddr: myAddress, Pagination: pageRequest},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			delegatorValidators = append(delegatorValidators, stakingRes.Validators...)
+			return stakingRes.Pagination, nil
+		})
+		if err != nil {
+			sublogger.Error().
+				Str("address", address).
+				Err(err).
+				Msg("Could not get delegator validators")
+			return err
+		}
+
+		sublogger.Debug().
+			Str("address", address).
+			Float64("request-time", time.Since(queryStart).Seconds()).
+			Msg("Finished querying delegator validators")
+		return nil
+	})
+
+	scrape.Go(func() error {
+		var err error
+		apr, err = FetchStakingAPR(ctx, scrape, network, capabilities)
+		return err
+	})
+
+	// the projected rewards need the delegations, their validators and the APR,
+	// the errors are returned by the scrape.Wait() below
+	_ = scrape.Wait()
+
+	if apr == nil {
+		return scrape.Wait()
+	}
+
+	validatorsByAddress := make(map[string]stakingtypes.Validator, len(delegatorValidators))
+	for _, validator := range delegatorValidators {
+		validatorsByAddress[validator.OperatorAddress] = validator
+	}
+
+	for _, delegation := range delegations {
+		validator, ok := validatorsByAddress[delegation.Delegation.ValidatorAddress]
+		if !ok {
+			continue
+		}
+
+		// only the bonded validators get rewards
+		projectedRewards := sdk.ZeroDec()
+		if validator.IsBonded() {
+			projectedRewards = sdk.NewDecFromInt(delegation.Balance.Amount).
+				Mul(apr.ValidatorAPR(validator.Commission.CommissionRates.Rate))
+		}
+
+		walletProjectedRewardsGauge.With(prometheus.Labels{
+			"address":           address,
+			"denom":             denoms.Denom,
+			"validator_address": delegation.Delegation.ValidatorAddress,
+		}).Set(denoms.BondAmount(projectedRewards))
+	}
+
+	return scrape.Wait()
 }